@@ -0,0 +1,429 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/zc2638/ddshop/core"
+)
+
+func NewCartCommand(opt *Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cart",
+		Short: "查看和调整购物车",
+	}
+	cmd.AddCommand(
+		newCartListCommand(opt),
+		newCartAddCommand(opt),
+		newCartRemoveCommand(opt),
+		newCartSetCountCommand(opt),
+		newCartCheckCommand(opt, true),
+		newCartCheckCommand(opt, false),
+		newCartOptimizeCommand(opt),
+		newCartSelectCommand(opt),
+	)
+	return cmd
+}
+
+// cartItem 购物车商品的展示内容
+type cartItem struct {
+	Id            string     `json:"id"`
+	Name          string     `json:"name"`
+	Price         core.Money `json:"price"`
+	Count         int        `json:"count"`
+	StockNumber   int        `json:"stock_number"`
+	TodayStockout string     `json:"today_stockout"`
+	BuyLimit      int        `json:"buy_limit"`
+	Checked       bool       `json:"checked"`
+	Invalid       bool       `json:"invalid"`
+	// 不会下单或无法全部下单的原因
+	Reason string `json:"reason,omitempty"`
+}
+
+func newCartItem(p core.Product, invalid bool, reason string) cartItem {
+	return cartItem{
+		Id:            p.Id,
+		Name:          p.ProductName,
+		Price:         p.Price,
+		Count:         p.Count,
+		StockNumber:   p.StockNumber,
+		TodayStockout: p.TodayStockout,
+		BuyLimit:      p.BuyLimit,
+		Checked:       p.IsCheck == 1,
+		Invalid:       invalid,
+		Reason:        reason,
+	}
+}
+
+// loadCart 获取购物车，所有购物车子命令共用
+func loadCart(opt *Option) (*core.Session, error) {
+	session, err := prepare(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := session.GetCart(); err != nil {
+		return nil, fmt.Errorf("获取购物车失败: %v", err)
+	}
+	return session, nil
+}
+
+// findCartItems 按商品ID和名称正则查找购物车商品，includeInvalid 为 true 时包括失效商品
+func findCartItems(cart *core.Cart, ids, patterns []string, includeInvalid bool) ([]core.Product, error) {
+	matchers := make([]core.ProductMatcher, 0, len(ids)+len(patterns))
+	for _, id := range ids {
+		matchers = append(matchers, core.ProductMatcher{ID: id})
+	}
+	for _, pattern := range patterns {
+		matchers = append(matchers, core.ProductMatcher{Pattern: pattern})
+	}
+	matchers, err := core.CompileMatchers(matchers)
+	if err != nil {
+		return nil, err
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("请指定商品ID或 --pattern")
+	}
+
+	products := cart.Items
+	if includeInvalid {
+		products = append(append([]core.Product(nil), cart.Items...), cart.Invalid...)
+	}
+	var result []core.Product
+	for _, p := range products {
+		if core.MatchProduct(matchers, p) {
+			result = append(result, p)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("购物车中没有匹配的商品")
+	}
+	return result, nil
+}
+
+func newCartListCommand(opt *Option) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "查看购物车商品",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			reasons := make(map[string]string)
+			for _, u := range session.UnavailableProducts() {
+				reasons[u.Product.Id] = u.Reason
+			}
+			items := make([]cartItem, 0, len(session.Cart.Items)+len(session.Cart.Invalid))
+			for _, p := range session.Cart.Items {
+				items = append(items, newCartItem(p, false, reasons[p.Id]))
+			}
+			for _, p := range session.Cart.Invalid {
+				items = append(items, newCartItem(p, true, reasons[p.Id]))
+			}
+
+			switch output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(items)
+			case "table":
+				printCartItems(items)
+				return nil
+			}
+			return fmt.Errorf("不支持的输出格式: %s", output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "设置输出格式(table/json)")
+	return cmd
+}
+
+func printCartItems(items []cartItem) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t商品\t单价\t数量\t库存\t今日缺货\t限购\t状态\t说明")
+	for _, item := range items {
+		status := "未勾选"
+		switch {
+		case item.Invalid:
+			status = "已失效"
+		case item.Checked:
+			status = "已勾选"
+		}
+		buyLimit := "-"
+		if item.BuyLimit > 0 {
+			buyLimit = strconv.Itoa(item.BuyLimit)
+		}
+		todayStockout := item.TodayStockout
+		if todayStockout == "" {
+			todayStockout = "-"
+		}
+		reason := item.Reason
+		if reason == "" {
+			reason = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			item.Id, item.Name, item.Price, item.Count, item.StockNumber, todayStockout, buyLimit, status, reason)
+	}
+	_ = w.Flush()
+}
+
+func newCartAddCommand(opt *Option) *cobra.Command {
+	var count int
+	cmd := &cobra.Command{
+		Use:   "add <product-id>",
+		Short: "将商品加入购物车",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count < 1 {
+				return fmt.Errorf("商品数量必须大于0")
+			}
+			session, err := prepare(opt)
+			if err != nil {
+				return err
+			}
+			if err := session.AddCart(args[0], count); err != nil {
+				return fmt.Errorf("加入购物车失败: %v", err)
+			}
+			fmt.Printf("已将商品 %s x%d 加入购物车\n", args[0], count)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&count, "count", 1, "设置加购数量")
+	return cmd
+}
+
+func newCartRemoveCommand(opt *Option) *cobra.Command {
+	var patterns []string
+	cmd := &cobra.Command{
+		Use:   "remove [product-id...]",
+		Short: "从购物车删除商品(包括失效商品)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			products, err := findCartItems(session.Cart, args, patterns, true)
+			if err != nil {
+				return err
+			}
+			if err := session.RemoveCart(products...); err != nil {
+				return fmt.Errorf("删除购物车商品失败: %v", err)
+			}
+			for _, p := range products {
+				fmt.Printf("已删除: %s\n", p.ProductName)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&patterns, "pattern", nil, "设置商品名称正则")
+	return cmd
+}
+
+func newCartSetCountCommand(opt *Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-count <product-id> <count>",
+		Short: "修改购物车商品数量",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			count, err := strconv.Atoi(args[1])
+			if err != nil || count < 1 {
+				return fmt.Errorf("商品数量必须为大于0的整数: %s", args[1])
+			}
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			products, err := findCartItems(session.Cart, args[:1], nil, false)
+			if err != nil {
+				return err
+			}
+			p := products[0]
+			if err := session.UpdateCart(p, count); err != nil {
+				return fmt.Errorf("修改商品数量失败: %v", err)
+			}
+			fmt.Printf("%s 数量 %d -> %d\n", p.ProductName, p.Count, count)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newCartCheckCommand(opt *Option, check bool) *cobra.Command {
+	use, short, action := "check", "勾选购物车商品", "已勾选"
+	if !check {
+		use, short, action = "uncheck", "取消勾选购物车商品", "已取消勾选"
+	}
+	var patterns []string
+	cmd := &cobra.Command{
+		Use:   use + " [product-id...]",
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			products, err := findCartItems(session.Cart, args, patterns, false)
+			if err != nil {
+				return err
+			}
+			for _, p := range products {
+				if (p.IsCheck == 1) == check {
+					continue
+				}
+				if err := session.CheckCart(p, check); err != nil {
+					return fmt.Errorf("修改商品(%s)勾选状态失败: %v", p.ProductName, err)
+				}
+				fmt.Printf("%s: %s\n", action, p.ProductName)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&patterns, "pattern", nil, "设置商品名称正则")
+	return cmd
+}
+
+func newCartOptimizeCommand(opt *Option) *cobra.Command {
+	var (
+		budget, freight, threshold core.Money
+		apply                      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "optimize",
+		Short: "在预算内(含运费)按商品优先级挑选购物车商品及数量",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+
+			option := core.OptimizeOption{
+				Budget:               budget,
+				Freight:              freight,
+				FreeFreightThreshold: threshold,
+			}
+			if !cmd.Flags().Changed("free-freight-threshold") {
+				option.FreeFreightThreshold = session.FreeFreightThreshold(opt.Config.Filler.Threshold)
+			}
+			if option.FreeFreightThreshold <= 0 {
+				return fmt.Errorf("无法从购物车获取免运费门槛，请通过 --free-freight-threshold 或配置文件 filler.threshold 指定")
+			}
+			if !cmd.Flags().Changed("freight") {
+				// 购物车已免运费时返回的运费为 0，需要获取站点的原始运费
+				if option.Freight, err = session.BaseFreight(); err != nil {
+					return fmt.Errorf("%v，请通过 --freight 指定运费", err)
+				}
+			}
+			plan, err := session.OptimizeCart(option)
+			if err != nil {
+				return err
+			}
+			printCartPlan(plan)
+			if !apply {
+				return nil
+			}
+			if err := session.ApplyCartPlan(plan); err != nil {
+				return err
+			}
+			fmt.Println("已按方案调整购物车")
+			return nil
+		},
+	}
+	cmd.Flags().Var(moneyValue{&budget}, "budget", "设置预算上限(含运费)")
+	cmd.Flags().Var(moneyValue{&freight}, "freight", "设置未达免运费门槛时的运费，默认使用站点的运费")
+	cmd.Flags().Var(moneyValue{&threshold}, "free-freight-threshold", "设置免运费门槛，默认使用配置文件 filler.threshold 或购物车提示中的门槛")
+	cmd.Flags().BoolVar(&apply, "apply", false, "按方案调整购物车商品数量和勾选状态")
+	_ = cmd.MarkFlagRequired("budget")
+	return cmd
+}
+
+func newCartSelectCommand(opt *Option) *cobra.Command {
+	var ids, patterns []string
+	cmd := &cobra.Command{
+		Use:   "select",
+		Short: "只勾选匹配的购物车商品并取消勾选其余商品，默认使用配置文件 check",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			matchers := opt.Config.Check
+			if len(ids) > 0 || len(patterns) > 0 {
+				matchers = nil
+				for _, id := range ids {
+					matchers = append(matchers, core.ProductMatcher{ID: id})
+				}
+				for _, pattern := range patterns {
+					matchers = append(matchers, core.ProductMatcher{Pattern: pattern})
+				}
+			}
+			matchers, err := core.CompileMatchers(matchers)
+			if err != nil {
+				return err
+			}
+			if len(matchers) == 0 {
+				return fmt.Errorf("请通过 --id、--pattern 或配置文件 check 指定需要勾选的商品")
+			}
+
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			changed, err := session.SelectCart(matchers)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("已修改 %d 件商品的勾选状态\n", changed)
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&ids, "id", nil, "设置需要勾选的商品ID")
+	cmd.Flags().StringSliceVar(&patterns, "pattern", nil, "设置需要勾选的商品名称正则")
+	return cmd
+}
+
+func printCartPlan(plan *core.CartPlan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "商品\t单价\t数量\t小计")
+	for _, p := range plan.Products {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", p.ProductName, p.Price, p.Count, p.TotalPrice)
+	}
+	_ = w.Flush()
+	for _, p := range plan.Dropped {
+		fmt.Printf("不购买: %s\n", p.ProductName)
+	}
+	fmt.Printf("商品金额: %s，运费: %s，合计: %s，价值: %d\n", plan.Goods, plan.Freight, plan.Total(), plan.Value)
+}
+
+// moneyValue 将金额作为命令行参数解析
+type moneyValue struct {
+	m *core.Money
+}
+
+func (v moneyValue) String() string {
+	if v.m == nil {
+		return "0.00"
+	}
+	return v.m.String()
+}
+
+func (v moneyValue) Set(s string) error {
+	return v.m.UnmarshalText([]byte(s))
+}
+
+func (v moneyValue) Type() string {
+	return "money"
+}
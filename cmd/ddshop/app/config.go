@@ -0,0 +1,110 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/zc2638/ddshop/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 配置文件内容
+type Config struct {
+	// 订单金额上限，0 表示不限制
+	MaxPrice core.Money `yaml:"max_price"`
+	// 订单金额相对购物车金额的最大涨幅(%)，0 表示不限制
+	MaxPriceIncrease float64 `yaml:"max_price_increase"`
+	// 校验订单金额时允许的误差，用于抵消未返回明细的优惠，默认 0.1 元
+	PriceTolerance core.Money `yaml:"price_tolerance"`
+	// 商品优先级，整单无法下单时优先保证高优先级的商品
+	Priorities []core.PriorityRule `yaml:"priorities"`
+	// 替代商品，商品不可用时按顺序尝试加购替代商品
+	Substitutes []core.SubstituteRule `yaml:"substitutes"`
+	// 免运费凑单
+	Filler FillerConfig `yaml:"filler"`
+	// 优惠券使用策略
+	Coupon core.CouponPolicy `yaml:"coupon"`
+	// 积分和余额抵扣策略
+	Payment core.PaymentPolicy `yaml:"payment"`
+	// 下单前只勾选匹配的购物车商品，为空时勾选所有商品
+	Check []core.ProductMatcher `yaml:"check"`
+	// 购物清单文件路径，配置后启动时先按清单同步购物车
+	ShoppingList string `yaml:"shopping_list"`
+	// 换购和赠品策略
+	Activity core.ActivityPolicy `yaml:"activity"`
+	// 商品价格和库存记录
+	History HistoryConfig `yaml:"history"`
+	// 购物车商品缺货、移除、价格或数量变化时发送通知，变化始终会输出到日志
+	NotifyCartChanges bool `yaml:"notify_cart_changes"`
+}
+
+type HistoryConfig struct {
+	// 记录文件路径，为空时不记录
+	Path string `yaml:"path"`
+	// 降价时发送通知的商品ID
+	Watch []string `yaml:"watch"`
+}
+
+type FillerConfig struct {
+	// 免运费门槛金额，0 表示使用购物车提示中的门槛，无法获取时不凑单
+	Threshold core.Money `yaml:"threshold"`
+	// 差额不超过该金额时才凑单，0 表示不限制
+	MaxGap core.Money `yaml:"max_gap"`
+	// 是否自动将凑单商品加入购物车
+	AutoAdd bool `yaml:"auto_add"`
+	// 候选凑单商品ID
+	Products []string `yaml:"products"`
+}
+
+// defaultPriceTolerance 默认允许的订单金额误差
+const defaultPriceTolerance core.Money = 10
+
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{PriceTolerance: defaultPriceTolerance}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return cfg, nil
+}
+
+func applyConfig(session *core.Session, cfg *Config) error {
+	session.MaxPrice = cfg.MaxPrice
+	session.MaxPriceIncrease = cfg.MaxPriceIncrease
+	session.PriceTolerance = cfg.PriceTolerance
+	session.CouponPolicy = cfg.Coupon
+	session.PaymentPolicy = cfg.Payment
+	if err := session.SetPriorities(cfg.Priorities); err != nil {
+		return err
+	}
+	if err := session.SetSubstitutes(cfg.Substitutes); err != nil {
+		return err
+	}
+	if err := session.SetActivityPolicy(cfg.Activity); err != nil {
+		return err
+	}
+	if err := session.SetCheckRules(cfg.Check); err != nil {
+		return err
+	}
+	return nil
+}
@@ -16,11 +16,14 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 	"github.com/zc2638/ddshop/core"
+	"github.com/zc2638/ddshop/pkg/notice"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -29,37 +32,65 @@ const (
 )
 
 var (
-	successCh      = make(chan struct{}, 1)
+	successCh      = make(chan *core.CreateOrderResult, 1)
 	errCh          = make(chan error, 1)
 	onceCart       = sync.Once{}
 	onceCheckOrder = sync.Once{}
+	onceFiller     = sync.Once{}
+	onceCoupon     = sync.Once{}
+
+	violationMu   sync.Mutex
+	lastViolation string
+
+	unavailableMu   sync.Mutex
+	lastUnavailable string
 )
 
 // flow 主流程
-func flow(session *core.Session) error {
+func flow(session *core.Session, ins notice.Interface, cfg *Config) error {
+	// 每轮重新按完整的购物车下单并重新尝试使用积分，恢复供应的商品不受上一轮缩减和缺货记录的影响
+	session.ResetTierLimit()
+	session.ResetStockout()
+	session.ResetPoints()
 	logrus.Info("获取购物车")
 	if err := session.GetCart(); err != nil {
 		return err
 	}
+	if err := substitute(session, session.Cart.Invalid); err != nil {
+		return err
+	}
 	if len(session.Cart.ProdList) == 0 {
+		reportUnavailable(ins, session.UnavailableProducts())
 		return core.ErrorNoValidProduct
 	}
+	onceFiller.Do(func() {
+		fillFreight(session, cfg.Filler)
+	})
+	onceCoupon.Do(func() {
+		if err := session.LoadCoupons(); err != nil {
+			logrus.Warningf("获取优惠券失败，不自动选择优惠券: %v", err)
+		}
+	})
 	onceCart.Do(func() {
 		logrus.Info("-----------购物车守护程序启动--------------")
 		core.WrapFun(session.GetCart)
 	})
-	logrus.Info("全选购物车")
-	if err := session.CartAllCheck(); err != nil {
-		return fmt.Errorf("全选购车车商品失败: %v", err)
+	logrus.Info("勾选购物车商品")
+	if err := session.CheckCartItems(); err != nil {
+		return fmt.Errorf("勾选购物车商品失败: %v", err)
 	}
+	// 以首次勾选后的购物车金额作为订单金额涨幅的基准
+	session.SetPriceBaseline()
 
 	logrus.Info("运力检查")
 	_ = session.OrderFlashSale()
 
 	logrus.Info("订单检查")
-	if err := session.CheckOrder(); err != nil {
-		return fmt.Errorf("检查订单失败: %v", err)
+	if err := checkOrder(session); err != nil {
+		return err
 	}
+	// 勾选和检查订单后购物车及下单商品已更新
+	reportUnavailable(ins, session.UnavailableProducts())
 	onceCheckOrder.Do(func() {
 		logrus.Info("-----------检查订单守护程序启动--------------")
 		core.WrapFun(session.CheckOrder)
@@ -70,28 +101,259 @@ func flow(session *core.Session) error {
 	if err != nil {
 		return fmt.Errorf("获取可预约时间失败: %v", err)
 	}
-	if len(multiReserveTime) == 0 {
+	reservePlans := core.ReserveTimePlans(multiReserveTime)
+	if len(reservePlans) == 0 {
+		if len(multiReserveTime) > 1 {
+			logrus.Warningf("订单分为 %d 个包裹，没有各包裹均可预约的时间段组合", len(multiReserveTime))
+		}
 		return core.ErrorNoReserveTime
 	}
 
+	var freightChecked bool
+	for {
+		err := submitOrder(session, reservePlans)
+		if err == nil || core.StopDaemonThread {
+			return nil
+		}
+		var validationErr *core.ValidationError
+		if errors.As(err, &validationErr) {
+			notifyViolation(ins, validationErr)
+			return err
+		}
+		var stockoutErr *core.StockoutError
+		if errors.As(err, &stockoutErr) {
+			changed, err := removeStockout(session, stockoutErr.Products)
+			if err != nil {
+				return err
+			}
+			if changed {
+				logrus.Info("缺货商品已调整，重新检查订单")
+				if err := checkOrder(session); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		// 运费可能随购物车变化已过期，先按当前商品重新检查订单，仍不正确时再缩减商品
+		if errors.Is(err, core.ErrNoValidFreight) && !freightChecked {
+			freightChecked = true
+			logrus.Warningf("%v，重新检查订单", err)
+			if err := checkOrder(session); err != nil {
+				return err
+			}
+			continue
+		}
+		if !narrowOrder(session, err) {
+			return nil
+		}
+		if err := checkOrder(session); err != nil {
+			return err
+		}
+	}
+}
+
+// fillFreight 购物车金额接近免运费门槛时给出凑单建议，按配置自动加入购物车
+func fillFreight(session *core.Session, cfg FillerConfig) {
+	threshold := session.FreeFreightThreshold(cfg.Threshold)
+	if threshold <= 0 || len(cfg.Products) == 0 {
+		return
+	}
+	gap := session.FreeFreightGap(threshold)
+	if gap <= 0 || (cfg.MaxGap > 0 && gap > cfg.MaxGap) {
+		return
+	}
+	suggestion, err := session.SuggestFiller(threshold, cfg.Products)
+	if err != nil {
+		logrus.Warningf("凑单失败: %v", err)
+		return
+	}
+	logrus.Warning(suggestion)
+	if !cfg.AutoAdd {
+		return
+	}
+	if err := session.ApplyFiller(suggestion); err != nil {
+		logrus.Warningf("凑单失败: %v", err)
+		return
+	}
+	logrus.Info("凑单商品已加入购物车")
+}
+
+// substitute 为不可用的商品加购替代商品
+func substitute(session *core.Session, unavailable []core.Product) error {
+	subs, err := session.Substitute(unavailable)
+	for _, sub := range subs {
+		logrus.Warningf("商品替换: %s", sub)
+	}
+	if err != nil {
+		return fmt.Errorf("替换商品失败: %v", err)
+	}
+	return nil
+}
+
+// removeStockout 从订单中移除缺货商品并加购替代商品，返回下单商品是否发生变化
+func removeStockout(session *core.Session, stockouts []core.Product) (bool, error) {
+	changes := session.RemoveStockout(stockouts)
+	for _, change := range changes {
+		logrus.Warningf("缺货调整: %s", change)
+	}
+	if err := substitute(session, stockouts); err != nil {
+		return false, err
+	}
+	if len(session.Order.Products) == 0 {
+		return false, core.ErrorNoValidProduct
+	}
+	return len(changes) > 0, nil
+}
+
+// checkOrder 检查订单，有缺货商品时移除后重新检查，整单无法下单时按优先级缩减商品后重试
+func checkOrder(session *core.Session) error {
+	for {
+		session.SelectCoupons()
+		err := session.CheckOrder()
+		var stockoutErr *core.StockoutError
+		if errors.As(err, &stockoutErr) {
+			changed, e := removeStockout(session, stockoutErr.Products)
+			if e != nil {
+				return e
+			}
+			if changed {
+				logrus.Info("检查订单发现缺货商品，已调整后重新检查")
+				continue
+			}
+		}
+		if err == nil {
+			err = session.CheckPriceLimit()
+		}
+		if err == nil {
+			return nil
+		}
+		if !narrowOrder(session, err) {
+			return fmt.Errorf("检查订单失败: %v", err)
+		}
+	}
+}
+
+// narrowOrder 因缺货、运费或金额上限导致整单无法下单时，按优先级缩减为更小的订单
+// 缩减会降低商品金额，无法满足运费门槛时不缩减
+func narrowOrder(session *core.Session, reason error) bool {
+	var stockoutErr *core.StockoutError
+	if !errors.Is(reason, core.ErrNoValidFreight) &&
+		!errors.Is(reason, core.ErrOverPriceLimit) &&
+		!errors.As(reason, &stockoutErr) {
+		return false
+	}
+	if !session.NarrowOrder() {
+		return false
+	}
+	names := make([]string, 0, len(session.Order.Products))
+	for _, p := range session.Order.Products {
+		names = append(names, p.ProductName)
+	}
+	logrus.Warningf("%v，缩减为优先级 %d 及以上的商品下单: %s", reason, session.TierLimit(), strings.Join(names, ", "))
+	return true
+}
+
+// notifyViolation 订单校验未通过时发送通知，相同的问题只通知一次
+func notifyViolation(ins notice.Interface, err *core.ValidationError) {
+	msg := strings.Join(err.Violations, "\n")
+	violationMu.Lock()
+	defer violationMu.Unlock()
+	if msg == lastViolation {
+		return
+	}
+	lastViolation = msg
+	notify(ins, "订单校验未通过，已阻止提交", msg)
+}
+
+// reportUnavailable 输出并通知不会下单的商品，内容未变化时不重复通知
+func reportUnavailable(ins notice.Interface, unavailable []core.UnavailableProduct) {
+	lines := make([]string, 0, len(unavailable))
+	for _, u := range unavailable {
+		lines = append(lines, u.String())
+	}
+	msg := strings.Join(lines, "\n")
+	unavailableMu.Lock()
+	defer unavailableMu.Unlock()
+	if msg == lastUnavailable {
+		return
+	}
+	lastUnavailable = msg
+	if msg == "" {
+		return
+	}
+	notify(ins, "以下购物车商品不会下单", msg)
+}
+
+// submitOrder 按各包裹可预约时间段的组合并发提交订单
+func submitOrder(session *core.Session, reservePlans [][]core.ReserveTime) error {
 	wg, _ := errgroup.WithContext(context.Background())
 	for i := 0; i < _payOrderParaNum; i++ {
-		for _, reserveTime := range multiReserveTime {
+		for _, reserveTimes := range reservePlans {
 			sess := session.Clone()
-			sess.UpdatePackageOrder(reserveTime)
+			if err := sess.UpdatePackageOrder(reserveTimes...); err != nil {
+				// 包裹与可预约时间段不一致时无法提交，等待已发出的请求结束
+				_ = wg.Wait()
+				return fmt.Errorf("设置预约时间失败: %v", err)
+			}
 			wg.Go(func() error {
-				timeRange := session.GetReservedTimeRange()
-				if err := sess.CreateOrder(context.Background()); err != nil {
+				timeRange := sess.GetReservedTimeRange()
+				result, err := sess.CreateOrder(context.Background())
+				if err != nil {
 					logrus.Warningf("提交订单(%s)失败: %v", timeRange, err)
 					return err
 				}
 				logrus.Warningf("提交订单(%s)成功！", timeRange)
-				successCh <- struct{}{}
+				successCh <- result
 				core.StopDaemonThread = true
 				return nil
 			})
 		}
 	}
-	_ = wg.Wait()
-	return nil
+	return wg.Wait()
+}
+
+// orderSummary 生成下单成功的订单摘要
+func orderSummary(result *core.CreateOrderResult) string {
+	var sb strings.Builder
+	if len(result.OrderIds) > 0 {
+		sb.WriteString(fmt.Sprintf("订单号: %s\n", strings.Join(result.OrderIds, ", ")))
+	}
+	sb.WriteString(fmt.Sprintf("配送时间: %s\n", result.ReserveTime))
+	if !result.PayExpireTime.IsZero() {
+		sb.WriteString(fmt.Sprintf("请在 %s 前完成支付\n", result.PayExpireTime.Format("2006/01/02 15:04:05")))
+	}
+
+	order := result.Order
+	for _, p := range order.Products {
+		sb.WriteString(fmt.Sprintf("%s x%d %s\n", p.ProductName, p.Count, p.TotalPrice))
+	}
+	for _, p := range result.StockoutProducts {
+		sb.WriteString(fmt.Sprintf("缺货: %s\n", p.ProductName))
+	}
+	for _, u := range result.Unavailable {
+		sb.WriteString(fmt.Sprintf("未下单: %s\n", u))
+	}
+	for _, sub := range order.Substitutions {
+		sb.WriteString(fmt.Sprintf("替换: %s\n", sub))
+	}
+	for _, c := range []*core.Coupon{order.UserTicket, order.FreightTicket} {
+		if c != nil {
+			sb.WriteString(fmt.Sprintf("优惠券: %s\n", c))
+		}
+	}
+	if order.CouponMoney > 0 {
+		sb.WriteString(fmt.Sprintf("优惠金额: %s\n", order.CouponMoney))
+	}
+	sb.WriteString(fmt.Sprintf("共 %d 件商品，订单金额: %s", len(order.Products), result.Price))
+	return sb.String()
+}
+
+// costSplit 按成员分摊订单金额
+func costSplit(result *core.CreateOrderResult, attribution core.Attribution) string {
+	var sb strings.Builder
+	sb.WriteString("成员分摊:")
+	for _, c := range core.SplitCost(result, attribution) {
+		sb.WriteString(fmt.Sprintf("\n%s", c))
+	}
+	return sb.String()
 }
@@ -0,0 +1,95 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/zc2638/ddshop/core"
+)
+
+func NewHistoryCommand(opt *Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "查看本地记录的商品价格和库存变化",
+	}
+	cmd.AddCommand(newHistoryProductCommand(opt))
+	return cmd
+}
+
+func newHistoryProductCommand(opt *Option) *cobra.Command {
+	var (
+		path  string
+		limit int
+	)
+	cmd := &cobra.Command{
+		Use:   "product <product-id>",
+		Short: "查看商品的价格和库存变化",
+		Long:  "查看商品的价格和库存变化，记录文件同一时间只能被一个进程打开，需要在使用该文件的 ddshop 退出后查看",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" {
+				cfg, err := loadConfig(opt.ConfigPath)
+				if err != nil {
+					return err
+				}
+				path = cfg.History.Path
+			}
+			if path == "" {
+				return fmt.Errorf("请通过 --db 或配置文件 history.path 指定记录文件")
+			}
+			store, err := core.OpenHistoryStore(path)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			observations, err := store.Product(args[0], limit)
+			if err != nil {
+				return fmt.Errorf("读取商品记录失败: %v", err)
+			}
+			if len(observations) == 0 {
+				fmt.Println("没有该商品的记录")
+				return nil
+			}
+			printObservations(observations)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&path, "db", "", "设置记录文件路径，默认使用配置文件 history.path")
+	cmd.Flags().IntVar(&limit, "limit", 50, "设置显示最近的记录数，0 表示全部")
+	return cmd
+}
+
+func printObservations(observations []core.Observation) {
+	fmt.Printf("%s(%s)\n", observations[len(observations)-1].ProductName, observations[0].ProductId)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "时间\t单价\t原价\t库存\t状态\t来源")
+	for _, o := range observations {
+		status := "可购买"
+		switch {
+		case o.TodayStockout != "":
+			status = "今日缺货"
+		case !o.Available:
+			status = "售罄"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			o.Time.Format("2006/01/02 15:04:05"), o.Price, o.OriginPrice, o.StockNumber, status, o.Source)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,156 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zc2638/ddshop/core"
+	"gopkg.in/yaml.v3"
+)
+
+func NewListCommand(opt *Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "按购物清单管理购物车",
+	}
+	cmd.AddCommand(
+		newListSyncCommand(opt),
+		newListMergeCommand(opt),
+	)
+	return cmd
+}
+
+func newListSyncCommand(opt *Option) *cobra.Command {
+	var (
+		file   string
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "按购物清单加购、删除商品并调整数量",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				file = opt.Config.ShoppingList
+			}
+			if file == "" {
+				return fmt.Errorf("请通过 --file 或配置文件 shopping_list 指定购物清单")
+			}
+			list, err := loadShoppingList(file)
+			if err != nil {
+				return err
+			}
+			return syncShoppingList(session, list, dryRun)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "设置购物清单文件路径，默认使用配置文件 shopping_list")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只输出调整方案，不修改购物车")
+	return cmd
+}
+
+func loadShoppingList(path string) (*core.ShoppingList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取购物清单失败: %v", err)
+	}
+	list := &core.ShoppingList{}
+	if err := yaml.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("解析购物清单失败: %v", err)
+	}
+	return list, nil
+}
+
+// syncShoppingList 按购物清单调整购物车，调用前需要先获取购物车
+func syncShoppingList(session *core.Session, list *core.ShoppingList, dryRun bool) error {
+	actions, err := session.PlanSync(list)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, a := range actions {
+		if a.Action == core.SyncKeep {
+			continue
+		}
+		changed = true
+		logrus.Infof("购物清单同步: %s", a)
+	}
+	if !changed {
+		logrus.Info("购物车与购物清单一致")
+	}
+	if dryRun {
+		return nil
+	}
+	return session.ApplySync(actions)
+}
+
+func newListMergeCommand(opt *Option) *cobra.Command {
+	var (
+		output string
+		apply  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "merge <list.yaml>...",
+		Short: "合并家庭成员的购物清单，记录每个成员需要的商品",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lists := make([]*core.ShoppingList, 0, len(args))
+			for _, path := range args {
+				list, err := loadShoppingList(path)
+				if err != nil {
+					return err
+				}
+				if list.Member == "" {
+					list.Member = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+				}
+				lists = append(lists, list)
+			}
+			merged, conflicts := core.MergeShoppingLists(lists)
+			for _, c := range conflicts {
+				logrus.Warning(c)
+			}
+
+			data, err := yaml.Marshal(merged)
+			if err != nil {
+				return fmt.Errorf("生成购物清单失败: %v", err)
+			}
+			if output == "" {
+				fmt.Print(string(data))
+			} else if err := ioutil.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("写入购物清单失败: %v", err)
+			}
+			if !apply {
+				return nil
+			}
+
+			session, err := loadCart(opt)
+			if err != nil {
+				return err
+			}
+			return syncShoppingList(session, merged, false)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "设置合并后购物清单的保存路径，默认输出到终端")
+	cmd.Flags().BoolVar(&apply, "apply", false, "按合并后的购物清单同步购物车")
+	return cmd
+}
@@ -0,0 +1,172 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/zc2638/ddshop/core"
+)
+
+// productAddOption 查询商品后加入购物车的参数
+type productAddOption struct {
+	add   bool
+	count int
+	size  string
+}
+
+func (o *productAddOption) bind(cmd *cobra.Command, usage string) {
+	cmd.Flags().BoolVar(&o.add, "add", false, usage)
+	cmd.Flags().IntVar(&o.count, "count", 1, "设置加购数量")
+	cmd.Flags().StringVar(&o.size, "size", "", "设置加购的规格名称")
+}
+
+func (o *productAddOption) addCart(session *core.Session, p core.Product) error {
+	if o.count < 1 {
+		return fmt.Errorf("商品数量必须大于0")
+	}
+	sizes, ok := core.SelectSize(p, o.size)
+	if !ok {
+		return fmt.Errorf("商品(%s)没有规格: %s", p.ProductName, o.size)
+	}
+	if err := session.AddCartWithSizes(p.Id, o.count, sizes); err != nil {
+		return fmt.Errorf("加入购物车失败: %v", err)
+	}
+	fmt.Printf("已将商品 %s x%d 加入购物车\n", p.ProductName, o.count)
+	return nil
+}
+
+func NewProductCommand(opt *Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "product",
+		Short: "搜索和查看当前站点的商品",
+	}
+	cmd.AddCommand(
+		newProductSearchCommand(opt),
+		newProductShowCommand(opt),
+	)
+	return cmd
+}
+
+func newProductSearchCommand(opt *Option) *cobra.Command {
+	addOpt := &productAddOption{}
+	cmd := &cobra.Command{
+		Use:   "search <keyword>",
+		Short: "搜索商品，--add 将第一个可购买的商品加入购物车",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := prepare(opt)
+			if err != nil {
+				return err
+			}
+			products, err := session.SearchProducts(args[0])
+			if err != nil {
+				return fmt.Errorf("搜索商品失败: %v", err)
+			}
+			if len(products) == 0 {
+				fmt.Println("未搜索到商品")
+				return nil
+			}
+			printProducts(products)
+			if !addOpt.add {
+				return nil
+			}
+			for _, p := range products {
+				if p.Available() {
+					return addOpt.addCart(session, p)
+				}
+			}
+			return fmt.Errorf("没有可购买的商品")
+		},
+	}
+	addOpt.bind(cmd, "将第一个可购买的商品加入购物车")
+	return cmd
+}
+
+func newProductShowCommand(opt *Option) *cobra.Command {
+	addOpt := &productAddOption{}
+	cmd := &cobra.Command{
+		Use:   "show <product-id>",
+		Short: "查看商品详情",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := prepare(opt)
+			if err != nil {
+				return err
+			}
+			p, err := session.GetProduct(args[0])
+			if err != nil {
+				return fmt.Errorf("获取商品详情失败: %v", err)
+			}
+			printProduct(*p)
+			if !addOpt.add {
+				return nil
+			}
+			return addOpt.addCart(session, *p)
+		},
+	}
+	addOpt.bind(cmd, "将商品加入购物车")
+	return cmd
+}
+
+// sizeOptions 商品可选的规格名称
+func sizeOptions(p core.Product) string {
+	names := make([]string, 0, len(p.Sizes))
+	for _, size := range p.Sizes {
+		if name := core.SizeName(size); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, "/")
+}
+
+func printProducts(products []core.Product) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t商品\t单价\t库存\t限购\t规格")
+	for _, p := range products {
+		buyLimit := "-"
+		if p.BuyLimit > 0 {
+			buyLimit = fmt.Sprint(p.BuyLimit)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			p.Id, p.ProductName, p.Price, p.StockNumber, buyLimit, sizeOptions(p))
+	}
+	_ = w.Flush()
+}
+
+func printProduct(p core.Product) {
+	fmt.Printf("ID: %s\n", p.Id)
+	fmt.Printf("商品: %s\n", p.ProductName)
+	fmt.Printf("单价: %s", p.Price)
+	if p.OriginPrice > p.Price {
+		fmt.Printf("(原价 %s)", p.OriginPrice)
+	}
+	fmt.Println()
+	fmt.Printf("库存: %d\n", p.StockNumber)
+	if p.TodayStockout != "" {
+		fmt.Printf("今日缺货: %s\n", p.TodayStockout)
+	}
+	if p.BuyLimit > 0 {
+		fmt.Printf("限购: %d\n", p.BuyLimit)
+	}
+	fmt.Printf("规格: %s\n", sizeOptions(p))
+}
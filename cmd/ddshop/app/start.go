@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/zc2638/ddshop/pkg/notice"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,9 +14,13 @@ import (
 )
 
 type Option struct {
-	Cookie   string
-	BarkKey  string
-	Interval int64
+	Cookie     string
+	BarkKey    string
+	Interval   int64
+	ConfigPath string
+	Config     *Config
+	// 购物清单中各商品对应的成员，用于下单后分摊金额
+	Attribution core.Attribution
 }
 
 const (
@@ -36,15 +41,35 @@ func NewRootCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if opt.Config.ShoppingList != "" {
+				if err := session.GetCart(); err != nil {
+					return fmt.Errorf("获取购物车失败: %v", err)
+				}
+				list, err := loadShoppingList(opt.Config.ShoppingList)
+				if err != nil {
+					return err
+				}
+				if err := syncShoppingList(session, list, false); err != nil {
+					return fmt.Errorf("同步购物清单失败: %v", err)
+				}
+				opt.Attribution = list.Attribution()
+			}
 
 			start(session, opt)
 
 			return monitor(opt)
 		},
 	}
-	cmd.Flags().StringVar(&opt.Cookie, "cookie", "", "设置用户个人cookie")
-	cmd.Flags().StringVar(&opt.BarkKey, "bark-key", "", "设置bark的通知key")
-	cmd.Flags().Int64Var(&opt.Interval, "interval", 300, "设置请求间隔时间(ms)")
+	cmd.PersistentFlags().StringVar(&opt.Cookie, "cookie", "", "设置用户个人cookie")
+	cmd.PersistentFlags().StringVar(&opt.BarkKey, "bark-key", "", "设置bark的通知key")
+	cmd.PersistentFlags().Int64Var(&opt.Interval, "interval", 300, "设置请求间隔时间(ms)")
+	cmd.PersistentFlags().StringVarP(&opt.ConfigPath, "config", "c", "", "设置配置文件路径")
+
+	cmd.AddCommand(NewWatchCommand(opt))
+	cmd.AddCommand(NewCartCommand(opt))
+	cmd.AddCommand(NewListCommand(opt))
+	cmd.AddCommand(NewProductCommand(opt))
+	cmd.AddCommand(NewHistoryCommand(opt))
 	return cmd
 }
 
@@ -53,11 +78,38 @@ func prepare(opt *Option) (session *core.Session, err error) {
 		err = errors.New("请输入用户Cookie")
 		return
 	}
+	if opt.Config, err = loadConfig(opt.ConfigPath); err != nil {
+		return
+	}
 	session = core.NewSession(opt.Cookie, opt.Interval)
+	if err = applyConfig(session, opt.Config); err != nil {
+		return
+	}
+	if opt.Config.NotifyCartChanges {
+		ins := newNotifier(opt)
+		session.SetCartChangeHandler(func(changes []core.CartChange) {
+			lines := make([]string, 0, len(changes))
+			for _, c := range changes {
+				lines = append(lines, c.String())
+			}
+			notify(ins, "购物车商品发生变化", strings.Join(lines, "\n"))
+		})
+	}
+	if opt.Config.History.Path != "" {
+		var store *core.HistoryStore
+		if store, err = core.OpenHistoryStore(opt.Config.History.Path); err != nil {
+			return
+		}
+		ins := newNotifier(opt)
+		session.SetHistory(store, opt.Config.History.Watch, func(drop core.PriceDrop) {
+			notify(ins, "关注的商品降价", drop.String())
+		})
+	}
 	if err = session.GetUser(); err != nil {
 		err = fmt.Errorf("获取用户信息失败: %v", err)
 		return
 	}
+	session.CheckPaymentPolicy()
 	if err = session.Choose(); err != nil {
 		return
 	}
@@ -65,13 +117,14 @@ func prepare(opt *Option) (session *core.Session, err error) {
 }
 
 func start(session *core.Session, opt *Option) {
+	ins := newNotifier(opt)
 	for i := 0; i < _operateParallelNum; i++ {
 		go func() {
 			for {
 				if core.StopDaemonThread {
 					return
 				}
-				if err := flow(session); err != nil {
+				if err := flow(session, ins, opt.Config); err != nil {
 					switch err {
 					case core.ErrorNoValidProduct, core.ErrNoValidFreight, core.ErrorNoReserveTime:
 						logrus.Errorf("%+v，%d 秒后退出！", err.Error(), 5)
@@ -97,16 +150,21 @@ func monitor(opt *Option) error {
 		return fmt.Errorf("程序执行%d分钟退出", _programRunTime/time.Minute)
 	case err := <-errCh:
 		return err
-	case <-successCh:
+	case result := <-successCh:
 		core.LoopRun(10, func() {
 			logrus.Info("抢菜成功，请尽快支付!")
 		})
+		summary := orderSummary(result)
+		if len(opt.Attribution) > 0 {
+			summary += "\n" + costSplit(result, opt.Attribution)
+		}
+		logrus.Info(summary)
 		if opt.BarkKey == "" {
 			return fmt.Errorf("Bark消息Key为nil")
 		}
 		ins := notice.NewBark(opt.BarkKey)
 		for i := 0; i < 120; i++ {
-			if err := ins.Send("抢菜成功", "叮咚抢菜成功，请尽快支付！"); err != nil {
+			if err := ins.Send("叮咚抢菜成功，请尽快支付！", summary); err != nil {
 				logrus.Warningf("Bark消息通知失败: %v", err)
 			}
 			time.Sleep(2 * time.Second)
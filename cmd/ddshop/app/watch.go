@@ -0,0 +1,204 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zc2638/ddshop/core"
+	"github.com/zc2638/ddshop/pkg/notice"
+)
+
+func NewWatchCommand(opt *Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "监控站点运力和商品库存并发送通知，不会下单",
+	}
+	cmd.AddCommand(
+		newWatchCapacityCommand(opt),
+		newWatchProductCommand(opt),
+	)
+	return cmd
+}
+
+func newWatchCapacityCommand(opt *Option) *cobra.Command {
+	var pollInterval time.Duration
+	cmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "监控当前收货地址所在站点的运力，出现可预约时间段时发送通知",
+		Long: "监控当前收货地址所在站点的运力，出现可预约时间段时发送通知。\n" +
+			"可预约时间按购物车中可下单的商品查询，购物车为空时无法监控。",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := prepare(opt)
+			if err != nil {
+				return err
+			}
+			if err := session.GetCart(); err != nil {
+				return fmt.Errorf("获取购物车失败: %v", err)
+			}
+			if len(session.Cart.ProdList) == 0 {
+				return errors.New("购物车中没有可下单的商品，无法查询可预约时间，请先加购商品")
+			}
+			watchCapacity(session, newNotifier(opt), pollInterval)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", time.Minute, "设置运力检查间隔")
+	return cmd
+}
+
+func newWatchProductCommand(opt *Option) *cobra.Command {
+	var pollInterval time.Duration
+	addOpt := &productAddOption{}
+	cmd := &cobra.Command{
+		Use:   "product <product-id>...",
+		Short: "监控商品在当前站点的库存，可购买时发送通知",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := prepare(opt)
+			if err != nil {
+				return err
+			}
+			watchProducts(session, newNotifier(opt), args, pollInterval, addOpt)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", time.Minute, "设置库存检查间隔")
+	addOpt.bind(cmd, "可购买时将商品加入购物车")
+	return cmd
+}
+
+// newNotifier 根据配置创建通知实例，未配置时返回 nil
+func newNotifier(opt *Option) notice.Interface {
+	if opt.BarkKey == "" {
+		return nil
+	}
+	return notice.NewBark(opt.BarkKey)
+}
+
+func notify(ins notice.Interface, title, body string) {
+	logrus.Warningf("%s: %s", title, body)
+	if ins == nil {
+		return
+	}
+	if err := ins.Send(title, body); err != nil {
+		logrus.Warningf("消息通知失败: %v", err)
+	}
+}
+
+func watchCapacity(session *core.Session, ins notice.Interface, interval time.Duration) {
+	known := make(map[int]struct{})
+	for {
+		reserveTimes, err := checkCapacity(session)
+		switch err {
+		case nil:
+		case core.ErrCapacityFull, core.ErrorNoReserveTime:
+			logrus.Infof("运力检查: %v", err)
+		case core.ErrorNoValidProduct:
+			logrus.Warning("购物车中没有可下单的商品，无法检查运力")
+			time.Sleep(interval)
+			continue
+		default:
+			// 请求失败时保留上一次的结果，避免网络抖动导致重复通知
+			logrus.Warningf("运力检查失败: %v", err)
+			time.Sleep(interval)
+			continue
+		}
+
+		current := make(map[int]struct{}, len(reserveTimes))
+		var added []string
+		for _, t := range reserveTimes {
+			current[t.StartTimestamp] = struct{}{}
+			if _, ok := known[t.StartTimestamp]; !ok {
+				added = append(added, t.String())
+			}
+		}
+		known = current
+		if len(added) > 0 {
+			notify(ins, "站点运力开放", "新增可预约时间段:\n"+strings.Join(added, "\n"))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// checkCapacity 检查站点运力以及当前购物车可预约的时间段
+func checkCapacity(session *core.Session) ([]core.ReserveTime, error) {
+	if err := session.GetCart(); err != nil {
+		return nil, err
+	}
+	if len(session.Cart.ProdList) == 0 {
+		return nil, core.ErrorNoValidProduct
+	}
+	if err := session.OrderFlashSale(); err != nil {
+		return nil, err
+	}
+	multiReserveTime, err := session.GetMultiReserveTime()
+	if err != nil {
+		return nil, err
+	}
+	// 以第一个包裹(即时配送)的时间段作为站点运力，其余包裹无可预约时间时同样无法下单
+	plans := core.ReserveTimePlans(multiReserveTime)
+	if len(plans) == 0 {
+		return nil, core.ErrorNoReserveTime
+	}
+	reserveTimes := make([]core.ReserveTime, 0, len(plans))
+	for _, plan := range plans {
+		reserveTimes = append(reserveTimes, plan[0])
+	}
+	return reserveTimes, nil
+}
+
+// watchProducts 监控商品库存，首次检查时可购买或从缺货变为可购买时发送通知
+func watchProducts(session *core.Session, ins notice.Interface, ids []string, interval time.Duration, addOpt *productAddOption) {
+	available := make(map[string]bool, len(ids))
+	added := make(map[string]struct{}, len(ids))
+	for {
+		var restocked []string
+		for _, id := range ids {
+			p, err := session.GetProduct(id)
+			if err != nil {
+				// 请求失败时保留上一次的结果，避免网络抖动导致重复通知
+				logrus.Warningf("商品(%s)库存检查失败: %v", id, err)
+				continue
+			}
+			now := p.Available()
+			before := available[id]
+			available[id] = now
+			logrus.Infof("商品库存: %s 库存 %d，单价 %s", p.ProductName, p.StockNumber, p.Price)
+			// 首次检查时已可购买同样通知
+			if !now || before {
+				continue
+			}
+			restocked = append(restocked, fmt.Sprintf("%s 库存 %d，单价 %s", p.ProductName, p.StockNumber, p.Price))
+			if _, ok := added[id]; ok || !addOpt.add {
+				continue
+			}
+			if err := addOpt.addCart(session, *p); err != nil {
+				logrus.Warningf("补货商品加入购物车失败: %v", err)
+				continue
+			}
+			added[id] = struct{}{}
+		}
+		if len(restocked) > 0 {
+			notify(ins, "商品可购买", strings.Join(restocked, "\n"))
+		}
+		time.Sleep(interval)
+	}
+}
@@ -35,9 +35,10 @@ func main() {
 	})
 	command := app.NewRootCommand()
 	goNow(command)
+	// 定时执行时需要阻塞主线程
 	//goWithSchedule6(command)
 	//goWithSchedule8(command)
-	select {}
+	//select {}
 }
 
 func goNow(command *cobra.Command) {
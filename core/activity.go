@@ -0,0 +1,176 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AddOnInclude = "include"
+	AddOnExclude = "exclude"
+)
+
+// ActivityInfo 购物车中商品所属的活动
+type ActivityInfo struct {
+	Id    string        `json:"id"`
+	Gifts []interface{} `json:"gifts"`
+}
+
+// ActivityPolicy 换购和赠品策略
+// 配置后从所有勾选商品(包括换购)中按策略选择下单商品，不再区分购物车模式
+type ActivityPolicy struct {
+	// 换购商品的默认处理方式: include 购买，exclude 不购买，默认购买
+	AddOn string `yaml:"add_on"`
+	// 按活动单独配置，优先于默认处理方式
+	Activities []ActivityRule `yaml:"activities"`
+}
+
+type ActivityRule struct {
+	ID string `yaml:"id"`
+	// 该活动换购商品的处理方式，为空时使用默认处理方式
+	AddOn string `yaml:"add_on"`
+	// 要求活动赠品仍然存在，赠品赠完时不购买该活动的商品
+	RequireGift bool `yaml:"require_gift"`
+}
+
+func (p *ActivityPolicy) enabled() bool {
+	return p.AddOn != "" || len(p.Activities) > 0
+}
+
+func (p *ActivityPolicy) rule(activityId string) *ActivityRule {
+	if activityId == "" {
+		return nil
+	}
+	for i := range p.Activities {
+		if p.Activities[i].ID == activityId {
+			return &p.Activities[i]
+		}
+	}
+	return nil
+}
+
+// decide 判断商品是否下单，返回判断的原因
+func (p *ActivityPolicy) decide(prod Product, addOn, hasGift bool) (bool, string) {
+	rule := p.rule(prod.ActivityId)
+	if rule != nil && rule.RequireGift && !hasGift {
+		return false, fmt.Sprintf("活动(%s)赠品已赠完", rule.ID)
+	}
+	if !addOn {
+		if rule != nil && rule.RequireGift {
+			return true, fmt.Sprintf("活动(%s)赠品仍有剩余", rule.ID)
+		}
+		return true, "有效商品"
+	}
+
+	mode := p.AddOn
+	if rule != nil && rule.AddOn != "" {
+		mode = rule.AddOn
+	}
+	if mode == AddOnExclude {
+		return false, fmt.Sprintf("换购商品(活动 %s)，策略为不购买", prod.ActivityId)
+	}
+	return true, fmt.Sprintf("换购商品(活动 %s)，策略为购买", prod.ActivityId)
+}
+
+// SetActivityPolicy 设置换购和赠品策略
+func (s *Session) SetActivityPolicy(policy ActivityPolicy) error {
+	check := func(addOn string) error {
+		switch addOn {
+		case "", AddOnInclude, AddOnExclude:
+			return nil
+		}
+		return fmt.Errorf("换购策略只能为 %s 或 %s: %s", AddOnInclude, AddOnExclude, addOn)
+	}
+	if err := check(policy.AddOn); err != nil {
+		return err
+	}
+	for _, rule := range policy.Activities {
+		if rule.ID == "" {
+			return fmt.Errorf("活动策略缺少id: %+v", rule)
+		}
+		if err := check(rule.AddOn); err != nil {
+			return err
+		}
+	}
+	s.activityPolicy = policy
+	return nil
+}
+
+// selectActivityProducts 按换购和赠品策略从所有勾选商品中选择下单商品
+func (s *Session) selectActivityProducts(data *ProductData) []Product {
+	effective := make(map[string]struct{})
+	gifts := make(map[string]bool)
+	for _, info := range data.Product.Effective {
+		if info.ActivityInfo.Id != "" && len(info.ActivityInfo.Gifts) > 0 {
+			gifts[info.ActivityInfo.Id] = true
+		}
+		for _, p := range info.Products {
+			effective[p.Id] = struct{}{}
+			if p.ActivityId != "" && len(p.Gifts) > 0 {
+				gifts[p.ActivityId] = true
+			}
+		}
+	}
+	for _, info := range data.NewOrderProductList {
+		for _, p := range info.Products {
+			if p.IsGift == 1 && p.ActivityId != "" {
+				gifts[p.ActivityId] = true
+			}
+		}
+	}
+
+	var products []Product
+	for _, info := range data.NewOrderProductList {
+		for _, p := range info.Products {
+			_, ok := effective[p.Id]
+			include, reason := s.activityPolicy.decide(p, !ok && p.IsGift == 0, gifts[p.ActivityId])
+			s.activityLog.record(p, include, reason)
+			if include {
+				products = append(products, p)
+			}
+		}
+	}
+	return products
+}
+
+// activityLog 记录商品的选择结果，仅在结果变化时输出日志，避免购物车守护程序重复输出
+type activityLog struct {
+	mu      sync.Mutex
+	reasons map[string]string
+}
+
+func newActivityLog() *activityLog {
+	return &activityLog{reasons: make(map[string]string)}
+}
+
+func (l *activityLog) record(p Product, include bool, reason string) {
+	action := "排除"
+	if include {
+		action = "下单"
+	}
+	msg := fmt.Sprintf("%s: %s", action, reason)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reasons[p.Id] == msg {
+		return
+	}
+	l.reasons[p.Id] = msg
+	logrus.Infof("%s %s", p.ProductName, msg)
+}
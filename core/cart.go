@@ -21,7 +21,7 @@ import (
 	"github.com/tidwall/gjson"
 	"net/http"
 	"net/url"
-	"sync"
+	"strings"
 )
 
 // {"success":true,"code":0,"msg":"success","data":{"product":{"effective":[{"activity_info":{"id":"","gifts":null},"products":[{"id":"5e3f82cf7cdbf0131769408b","type":0,"category":"58fbf4fb936edf42508b4654","price":"4.59","sizes":[],"count":1,"status":1,"gifts":[],"addTime":1649606883,"cart_id":"5e3f82cf7cdbf0131769408b","activity_id":"","sku_activity_id":"","conditions_num":"","activity_tag":"","category_path":"58f9d213936edfe4568b569a,58fbf4fb936edf42508b4654","manage_category_path":"21,25,27","total_price":"4.59","origin_price":"4.59","no_supplementary_price":"4.59","no_supplementary_total_price":"4.59","size_price":"0.00","add_price":"4.59","add_vip_price":"","price_type":0,"buy_limit":0,"promotion_num":0,"product_name":"生姜 约300g","product_type":0,"small_image":"https://img.ddimg.mobi/product/3e7b7be5aa0b91616204086733.jpg?width=800&height=800","all_sizes":[],"only_new_user":false,"is_check":1,"is_gift":0,"is_bulk":0,"view_total_weight":"份","net_weight":"300","net_weight_unit":"g","is_stock":false,"old_count":1,"stock_number":1,"not_meet":[],"is_presale":0,"presale_id":"","presale_type":0,"delivery_start_time":0,"delivery_end_time":0,"is_invoice":1,"is_onion":0,"sub_list":[],"is_booking":0,"today_stockout":"","storage_value_id":0,"temperature_layer":"","is_shared_station_product":0,"is_fresh_food":0,"accessory_gifts":[],"accessory_text":"","supplementary_list":[]},{"id":"5e721d22b0055a0b5f763edf","type":0,"category":"58fbf4fb936edf42508b4654","price":"4.99","sizes":[],"count":1,"status":1,"gifts":[],"addTime":1649606846,"cart_id":"5e721d22b0055a0b5f763edf","activity_id":"","sku_activity_id":"","conditions_num":"","activity_tag":"","category_path":"58f9d213936edfe4568b569a,58fbf4fb936edf42508b4654","manage_category_path":"21,25,28","total_price":"4.99","origin_price":"4.99","no_supplementary_price":"4.99","no_supplementary_total_price":"4.99","size_price":"0.00","add_price":"4.99","add_vip_price":"","price_type":0,"buy_limit":0,"promotion_num":0,"product_name":"蒜头 约250g","product_type":0,"small_image":"https://img.ddimg.mobi/product/da62352cab2281613723470985.jpg?width=800&height=800","all_sizes":[],"only_new_user":false,"is_check":1,"is_gift":0,"is_bulk":0,"view_total_weight":"份","net_weight":"250","net_weight_unit":"g","is_stock":false,"old_count":1,"stock_number":1,"not_meet":[],"is_presale":0,"presale_id":"","presale_type":0,"delivery_start_time":0,"delivery_end_time":0,"is_invoice":1,"is_onion":0,"sub_list":[],"is_booking":0,"today_stockout":"","storage_value_id":0,"temperature_layer":"","is_shared_station_product":0,"is_fresh_food":0,"accessory_gifts":[],"accessory_text":"","supplementary_list":[]}]}],"invalid":[{"products":[{"id":"614d6cce8f1ed4f0871a2ca9","type":0,"category":"","price":"29.90","sizes":[],"count":1,"status":1,"gifts":[],"addTime":1649607493,"cart_id":"614d6cce8f1ed4f0871a2ca9","activity_id":"","sku_activity_id":"","conditions_num":"","activity_tag":"","category_path":"","manage_category_path":"258,259,262","origin_price":"29.90","size_price":"0.00","add_price":"29.90","add_vip_price":"","price_type":0,"buy_limit":0,"promotion_num":0,"product_name":"必品阁白菜猪肉王水饺 600g/袋","product_type":0,"small_image":"https://imgnew.ddimg.mobi/product/7f2617ebacf147999a4d356d375e6acf.gif?width=800&height=800","only_new_user":false,"is_check":0,"is_gift":0,"is_bulk":0,"view_total_weight":"袋","net_weight":"600","net_weight_unit":"g","is_stock":true,"old_count":1,"stock_number":0,"not_meet":[],"is_presale":0,"presale_id":"","presale_type":0,"delivery_start_time":0,"delivery_end_time":0,"is_invoice":1,"is_onion":0,"sub_list":[],"is_booking":0,"today_stockout":"","promotion_info":"","storage_value_id":3,"temperature_layer":"-18℃以下","is_fresh_food":0},{"id":"58ba8c02916edf9e4cc23072","type":0,"category":"58fb3b89936edfe4568b58ec","price":"9.90","sizes":[],"count":1,"status":1,"gifts":[],"addTime":1649607194,"cart_id":"58ba8c02916edf9e4cc23072","activity_id":"","sku_activity_id":"","conditions_num":"","activity_tag":"","category_path":"58f9e5a1936edf89778b568b,58fb3b89936edfe4568b58ec","manage_category_path":"330,331,332","origin_price":"9.90","size_price":"0.00","add_price":"9.90","add_vip_price":"","price_type":0,"buy_limit":0,"promotion_num":0,"product_name":"海天金标生抽酱油 500ml/瓶","product_type":0,"small_image":"https://ddimg.ddxq.mobi/879853186f70b1521771055327.jpg!maicai.product.list","only_new_user":false,"is_check":0,"is_gift":0,"is_bulk":0,"view_total_weight":"瓶","net_weight":"500","net_weight_unit":"ml","is_stock":true,"old_count":1,"stock_number":0,"not_meet":[],"is_presale":0,"presale_id":"","presale_type":0,"delivery_start_time":0,"delivery_end_time":0,"is_invoice":1,"is_onion":0,"sub_list":[],"is_booking":0,"today_stockout":"","promotion_info":"","storage_value_id":0,"temperature_layer":"","is_fresh_food":0}]}]},"toast":"","alert":null,"all_activity_cart":[],"station_id":"5c04bdd0716de1403a8b679b","order_product_list":[],"new_order_product_list":[{"products":[{"type":1,"id":"5e3f82cf7cdbf0131769408b","price":"4.59","count":1,"description":"","sizes":[],"cart_id":"5e3f82cf7cdbf0131769408b","parent_id":"","parent_batch_type":-1,"category_path":"58f9d213936edfe4568b569a,58fbf4fb936edf42508b4654","manage_category_path":"21,25,27","activity_id":"","sku_activity_id":"","conditions_num":"","product_name":"生姜 约300g","product_type":0,"small_image":"https://img.ddimg.mobi/product/3e7b7be5aa0b91616204086733.jpg?width=800&height=800","total_price":"4.59","origin_price":"4.59","total_origin_price":"4.59","no_supplementary_price":"4.59","no_supplementary_total_price":"4.59","size_price":"0.00","buy_limit":0,"price_type":0,"promotion_num":0,"instant_rebate_money":"0.00","is_invoice":1,"sub_list":[],"is_booking":0,"is_bulk":0,"view_total_weight":"份","net_weight":"300","net_weight_unit":"g","storage_value_id":0,"temperature_layer":"","sale_batches":{"batch_type":-1},"is_shared_station_product":0,"is_gift":0,"supplementary_list":[],"order_sort":3,"is_presale":0},{"type":1,"id":"5e721d22b0055a0b5f763edf","price":"4.99","count":1,"description":"","sizes":[],"cart_id":"5e721d22b0055a0b5f763edf","parent_id":"","parent_batch_type":-1,"category_path":"58f9d213936edfe4568b569a,58fbf4fb936edf42508b4654","manage_category_path":"21,25,28","activity_id":"","sku_activity_id":"","conditions_num":"","product_name":"蒜头 约250g","product_type":0,"small_image":"https://img.ddimg.mobi/product/da62352cab2281613723470985.jpg?width=800&height=800","total_price":"4.99","origin_price":"4.99","total_origin_price":"4.99","no_supplementary_price":"4.99","no_supplementary_total_price":"4.99","size_price":"0.00","buy_limit":0,"price_type":0,"promotion_num":0,"instant_rebate_money":"0.00","is_invoice":1,"sub_list":[],"is_booking":0,"is_bulk":0,"view_total_weight":"份","net_weight":"250","net_weight_unit":"g","storage_value_id":0,"temperature_layer":"","sale_batches":{"batch_type":-1},"is_shared_station_product":0,"is_gift":0,"supplementary_list":[],"order_sort":4,"is_presale":0}],"total_money":"9.58","total_origin_money":"9.58","goods_real_money":"9.58","total_count":2,"cart_count":2,"is_presale":0,"instant_rebate_money":"0.00","used_balance_money":"0.00","can_used_balance_money":"0.00","used_point_num":0,"used_point_money":"0.00","can_used_point_num":0,"can_used_point_money":"0.00","is_share_station":0,"only_today_products":[],"only_tomorrow_products":[],"package_type":1,"package_id":1,"front_package_text":"即时配送","front_package_type":0,"front_package_stock_color":"#2FB157","front_package_bg_color":"#fbfefc"}],"order_product_list_sign":"d751713988987e9331980363e24189ce","full_to_off":"0.00","freight_money":"0.00","free_freight_type":3,"instant_rebate_money":"0.00","goods_real_money":"9.58","total_money":"9.58","is_select_detail":1,"good_max_count_toast":"订单商品明细行数超过最大限制，无法按商品明细开票","is_all_check":1,"onion_id":"","onion_tip":{"tip_name_type":0,"tip_name":"赠品小葱已赠完，如有需要可购买小葱","event_track_type":9},"cart_notice":"已免配送费","cart_notice_new":"免配送费","free_freight_notice":{},"cart_top_floor_info":[],"cart_count":2,"total_count":4,"product_num":{"5e721d22b0055a0b5f763edf":1,"614d6cce8f1ed4f0871a2ca9":1,"5e3f82cf7cdbf0131769408b":1,"58ba8c02916edf9e4cc23072":1},"stop_order_toast":"","gift_no_size_tip":"","is_hit_onion":false,"onion_ab_config":3,"is_hit_gift_size":true,"coupon_text_a":"","coupon_text_b":"","need_amount":"","is_vip_ticket":0,"coupon_amount":"","coupon_state":-1,"coupon_type":0,"next_recommend_coupon":{"coupon_text_a":null,"coupon_text_b":null,"need_amount":null,"is_vip_ticket":null,"is_common_ticket":null},"show_coupon_detail":false,"contains_advent_gift":0,"parent_order_info":{"parent_order_sign":"5192235f19162dbe7f1aa1cf749717ba","stockout_gift_product":[],"stockout_gift_text":"赠品赠完即止，不再补送，敬请谅解。","is_open_presale_use_virtual_stock":false},"is_support_merge_payment":1,"sodexo_nonsupport_product_list":[],"valid_product_counts":{"5e721d22b0055a0b5f763edf":1,"5e3f82cf7cdbf0131769408b":1}},"tradeTag":"success","server_time":1649627313,"is_trade":1}
@@ -59,7 +59,7 @@ type ProductData struct {
 	OnionTip             struct{}           `json:"onion_tip"`
 	CartNotice           string             `json:"cart_notice"`
 	CartNoticeNew        string             `json:"cart_notice_new"`
-	FreeFreightNotice    struct{}           `json:"free_freight_notice"`
+	FreeFreightNotice    json.RawMessage    `json:"free_freight_notice"`
 	CartTopFloorInfo     []interface{}      `json:"cart_top_floor_info"`
 	CartCount            int                `json:"cart_count"`
 	TotalCount           int                `json:"total_count"`
@@ -72,14 +72,15 @@ type ProductSet struct {
 }
 
 type ProductInfo struct {
-	Products []Product `json:"products"`
+	ActivityInfo ActivityInfo `json:"activity_info"`
+	Products     []Product    `json:"products"`
 }
 
 type Product struct {
 	Id                        string                   `json:"id"`
 	Type                      int                      `json:"type"`
 	Category                  string                   `json:"category"`
-	Price                     string                   `json:"price"`
+	Price                     Money                    `json:"price"`
 	Sizes                     []map[string]interface{} `json:"sizes"`
 	Count                     int                      `json:"count"`
 	Status                    int                      `json:"status"`
@@ -92,13 +93,14 @@ type Product struct {
 	ActivityTag               string                   `json:"activity_tag"`
 	CategoryPath              string                   `json:"category_path"`
 	ManageCategoryPath        string                   `json:"manage_category_path"`
-	TotalPrice                string                   `json:"total_price"`
-	OriginPrice               string                   `json:"origin_price"`
-	NoSupplementaryPrice      string                   `json:"no_supplementary_price"`
-	NoSupplementaryTotalPrice string                   `json:"no_supplementary_total_price"`
-	SizePrice                 string                   `json:"size_price"`
-	AddPrice                  string                   `json:"add_price"`
+	TotalPrice                Money                    `json:"total_price"`
+	OriginPrice               Money                    `json:"origin_price"`
+	NoSupplementaryPrice      Money                    `json:"no_supplementary_price"`
+	NoSupplementaryTotalPrice Money                    `json:"no_supplementary_total_price"`
+	SizePrice                 Money                    `json:"size_price"`
+	AddPrice                  Money                    `json:"add_price"`
 	AddVipPrice               string                   `json:"add_vip_price"`
+	InstantRebateMoney        Money                    `json:"instant_rebate_money"`
 	PriceType                 int                      `json:"price_type"`
 	BuyLimit                  int                      `json:"buy_limit"`
 	PromotionNum              int                      `json:"promotion_num"`
@@ -134,6 +136,10 @@ type Product struct {
 	AccessoryGifts            []interface{}            `json:"accessory_gifts"`
 	AccessoryText             string                   `json:"accessory_text"`
 	SupplementaryList         []interface{}            `json:"supplementary_list"`
+
+	// 商品所属的包裹，由购物车返回的包裹信息填充
+	PackageType int `json:"package_type,omitempty"`
+	PackageId   int `json:"package_id,omitempty"`
 }
 
 type OrderProductInfo struct {
@@ -210,9 +216,135 @@ type OrderProduct struct {
 	IsPresale              int           `json:"is_presale"`
 }
 
+// FreeFreightTypeFree 购物车免运费时返回的 free_freight_type，其他取值的含义未知，按购物车运费计算
+const FreeFreightTypeFree = 3
+
 type Cart struct {
+	// 购物车中所有有效商品，包括未勾选的商品
+	Items           []Product `json:"items"`
 	ProdList        []Product `json:"effective_products"`
-	ParentOrderSign string    `json:"parent_order_sign"`
+	Invalid         []Product `json:"invalid_products"`
+	TotalMoney      Money     `json:"total_money"`
+	FreightMoney    Money     `json:"freight_money"`
+	FreeFreightType int       `json:"free_freight_type"`
+	// 从免运费提示中解析的免运费门槛，0 表示未知
+	FreeFreightThreshold Money  `json:"free_freight_threshold"`
+	ParentOrderSign      string `json:"parent_order_sign"`
+}
+
+// findProduct 在有效商品中查找指定商品
+func (c *Cart) findProduct(id string) (Product, bool) {
+	for _, p := range c.ProdList {
+		if p.Id == id {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+// findItem 在购物车所有有效商品(包括未勾选)中查找指定商品
+func (c *Cart) findItem(id string) (Product, bool) {
+	for _, p := range c.Items {
+		if p.Id == id {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+func (s *Session) AddCart(id string, count int) error {
+	return s.AddCartWithSizes(id, count, nil)
+}
+
+// AddCartWithSizes 按指定规格将商品加入购物车
+func (s *Session) AddCartWithSizes(id string, count int, sizes []map[string]interface{}) error {
+	if sizes == nil {
+		sizes = []map[string]interface{}{}
+	}
+	// 已在购物车中的商品加购后数量增加
+	if p, ok := s.Cart.findItem(id); ok {
+		s.cartEdits.expect(id, p.Count+count)
+	}
+	err := s.postCart("https://maicai.api.ddxq.mobi/cart/add", map[string]interface{}{
+		"id":       id,
+		"cart_id":  id,
+		"count":    count,
+		"sizes":    sizes,
+		"is_check": 1,
+	})
+	if err != nil {
+		s.cartEdits.cancel(id)
+		return err
+	}
+	return nil
+}
+
+// UpdateCart 修改购物车商品数量
+func (s *Session) UpdateCart(p Product, count int) error {
+	s.cartEdits.expect(p.Id, count)
+	err := s.postCart("https://maicai.api.ddxq.mobi/cart/update", map[string]interface{}{
+		"id":       p.Id,
+		"cart_id":  p.CartId,
+		"count":    count,
+		"sizes":    p.Sizes,
+		"is_check": p.IsCheck,
+	})
+	if err != nil {
+		s.cartEdits.cancel(p.Id)
+	}
+	return err
+}
+
+// CheckCart 勾选或取消勾选购物车商品
+func (s *Session) CheckCart(p Product, check bool) error {
+	isCheck := 0
+	if check {
+		isCheck = 1
+	}
+	return s.postCart("https://maicai.api.ddxq.mobi/cart/check", map[string]interface{}{
+		"id":       p.Id,
+		"cart_id":  p.CartId,
+		"count":    p.Count,
+		"sizes":    p.Sizes,
+		"is_check": isCheck,
+	})
+}
+
+// RemoveCart 从购物车删除商品
+func (s *Session) RemoveCart(products ...Product) error {
+	items := make([]map[string]interface{}, 0, len(products))
+	for _, p := range products {
+		s.cartEdits.expect(p.Id, 0)
+		items = append(items, map[string]interface{}{
+			"id":      p.Id,
+			"cart_id": p.CartId,
+			"sizes":   p.Sizes,
+		})
+	}
+	if err := s.postCart("https://maicai.api.ddxq.mobi/cart/delete", items...); err != nil {
+		for _, p := range products {
+			s.cartEdits.cancel(p.Id)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Session) postCart(urlPath string, products ...map[string]interface{}) error {
+	productsJson, err := json.Marshal(products)
+	if err != nil {
+		return fmt.Errorf("marshal products info failed: %v", err)
+	}
+
+	params := s.buildURLParams(true)
+	params.Add("is_load", "1")
+	params.Add("products", string(productsJson))
+
+	req := s.client.R()
+	req.Header = s.buildHeader()
+	req.SetBody(strings.NewReader(params.Encode()))
+	_, err = s.execute(context.Background(), req, http.MethodPost, urlPath)
+	return err
 }
 
 func (s *Session) CartAllCheck() error {
@@ -252,24 +384,51 @@ func (s *Session) GetCart() error {
 		return err
 	}
 	//logrus.Info(fmt.Sprintf("请求购物车耗时%+v", time.Now().Sub(startTime)))
+	return s.applyCart(resp.Body())
+}
 
+// applyCart 解析购物车接口的响应并更新购物车
+func (s *Session) applyCart(body []byte) error {
 	var productResult ProductResult
-	if err := json.Unmarshal(resp.Body(), &productResult); err != nil {
-		return fmt.Errorf("parse response failed: %v, body: %v", err, resp.String())
+	if err := json.Unmarshal(body, &productResult); err != nil {
+		return fmt.Errorf("parse response failed: %v, body: %v", err, string(body))
 	}
-	jsonResult := gjson.ParseBytes(resp.Body())
-	mutex := sync.Mutex{}
-	mutex.Lock()
-	defer mutex.Unlock()
+	jsonResult := gjson.ParseBytes(body)
+	s.cartMu.Lock()
+	defer s.cartMu.Unlock()
 	s.Cart.ParentOrderSign = jsonResult.Get("data.parent_order_info.parent_order_sign").Str
-	switch s.CartMode {
-	case 1:
+	beforeItems, beforeInvalid := s.Cart.Items, s.Cart.Invalid
+	var invalid []Product
+	for _, v := range productResult.Data.Product.Invalid {
+		invalid = append(invalid, v.Products...)
+	}
+	s.Cart.Invalid = invalid
+	var items []Product
+	for _, v := range productResult.Data.Product.Effective {
+		items = append(items, v.Products...)
+	}
+	s.Cart.Items = items
+	s.observe(SourceCart, append(append([]Product(nil), items...), invalid...)...)
+	s.reportCartChanges(beforeItems, beforeInvalid)
+	var err error
+	if s.Cart.TotalMoney, err = ParseMoney(productResult.Data.TotalMoney); err != nil {
+		return fmt.Errorf("parse cart total failed: %v", err)
+	}
+	if s.Cart.FreightMoney, err = ParseMoney(productResult.Data.FreightMoney); err != nil {
+		return fmt.Errorf("parse cart freight failed: %v", err)
+	}
+	s.Cart.FreeFreightType = productResult.Data.FreeFreightType
+	s.Cart.FreeFreightThreshold = parseFreeFreightThreshold(s.Cart.TotalMoney, freeFreightNotices(&productResult.Data)...)
+	switch {
+	case s.activityPolicy.enabled():
+		s.Cart.ProdList = s.selectActivityProducts(&productResult.Data)
+	case s.CartMode == 1:
 		var products []Product
 		for _, v := range productResult.Data.Product.Effective {
 			products = append(products, v.Products...)
 		}
 		s.Cart.ProdList = products
-	case 2:
+	case s.CartMode == 2:
 		var products []Product
 		for _, v := range productResult.Data.NewOrderProductList {
 			products = append(products, v.Products...)
@@ -278,6 +437,7 @@ func (s *Session) GetCart() error {
 	default:
 		return fmt.Errorf("incorrect cart mode: %v", s.CartMode)
 	}
-	s.Order.Products = s.Cart.ProdList
+	markPackages(s.Cart.ProdList, productResult.Data.NewOrderProductList)
+	s.Order.Products = s.orderProducts(s.Cart.ProdList)
 	return nil
 }
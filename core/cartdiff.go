@@ -0,0 +1,186 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	CartChangeStockout = "stockout"
+	CartChangeRestock  = "restock"
+	CartChangePrice    = "price"
+	CartChangeCount    = "count"
+	CartChangeRemoved  = "removed"
+)
+
+// CartChange 两次获取购物车之间商品的变化
+type CartChange struct {
+	Type   string
+	Before Product
+	After  Product
+}
+
+func (c CartChange) String() string {
+	name := c.Before.ProductName
+	switch c.Type {
+	case CartChangeStockout:
+		if reason := soldOutReason(c.After); reason != "" {
+			return fmt.Sprintf("%s 缺货: %s", name, reason)
+		}
+		return fmt.Sprintf("%s 缺货: 已失效", name)
+	case CartChangeRestock:
+		return fmt.Sprintf("%s 恢复供应，库存 %d", name, c.After.StockNumber)
+	case CartChangePrice:
+		return fmt.Sprintf("%s 价格 %s -> %s", name, c.Before.Price, c.After.Price)
+	case CartChangeCount:
+		return fmt.Sprintf("%s 数量 %d -> %d", name, c.Before.Count, c.After.Count)
+	case CartChangeRemoved:
+		return fmt.Sprintf("%s 已从购物车移除", name)
+	}
+	return name
+}
+
+type cartEntry struct {
+	product   Product
+	available bool
+}
+
+// newCartSnapshot 购物车中的商品及是否可购买，失效商品均不可购买
+func newCartSnapshot(items, invalid []Product) map[string]cartEntry {
+	snapshot := make(map[string]cartEntry, len(items)+len(invalid))
+	for _, p := range items {
+		snapshot[p.Id] = cartEntry{product: p, available: p.Available()}
+	}
+	for _, p := range invalid {
+		snapshot[p.Id] = cartEntry{product: p}
+	}
+	return snapshot
+}
+
+// DiffCart 对比两次获取的购物车商品，按上一次的商品顺序返回变化
+func DiffCart(beforeItems, beforeInvalid, afterItems, afterInvalid []Product) []CartChange {
+	after := newCartSnapshot(afterItems, afterInvalid)
+	before := newCartSnapshot(beforeItems, beforeInvalid)
+
+	var changes []CartChange
+	for _, products := range [][]Product{beforeItems, beforeInvalid} {
+		for _, p := range products {
+			prev := before[p.Id]
+			cur, ok := after[p.Id]
+			if !ok {
+				changes = append(changes, CartChange{Type: CartChangeRemoved, Before: p})
+				continue
+			}
+			switch {
+			case prev.available && !cur.available:
+				changes = append(changes, CartChange{Type: CartChangeStockout, Before: p, After: cur.product})
+			case !prev.available && cur.available:
+				changes = append(changes, CartChange{Type: CartChangeRestock, Before: p, After: cur.product})
+			}
+			if p.Price != cur.product.Price {
+				changes = append(changes, CartChange{Type: CartChangePrice, Before: p, After: cur.product})
+			}
+			if p.Count != cur.product.Count {
+				changes = append(changes, CartChange{Type: CartChangeCount, Before: p, After: cur.product})
+			}
+		}
+	}
+	return changes
+}
+
+// cartEdits 会话自身对购物车的修改，对比购物车时不作为变化输出
+type cartEdits struct {
+	mu sync.Mutex
+	// 商品ID对应修改后的数量，0 表示删除
+	counts map[string]int
+}
+
+func newCartEdits() *cartEdits {
+	return &cartEdits{counts: make(map[string]int)}
+}
+
+// expect 记录即将发起的修改，修改失败时调用 cancel
+func (e *cartEdits) expect(id string, count int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts[id] = count
+}
+
+func (e *cartEdits) cancel(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.counts, id)
+}
+
+// consume 变化是否由会话自身的修改导致，匹配后不再忽略该商品的变化
+func (e *cartEdits) consume(c CartChange) bool {
+	var count int
+	switch c.Type {
+	case CartChangeRemoved:
+	case CartChangeCount:
+		count = c.After.Count
+	default:
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	expected, ok := e.counts[c.Before.Id]
+	if !ok || expected != count {
+		return false
+	}
+	delete(e.counts, c.Before.Id)
+	return true
+}
+
+// SetCartChangeHandler 设置购物车变化时的回调，用于发送通知
+func (s *Session) SetCartChangeHandler(fn func([]CartChange)) {
+	s.onCartChange = fn
+}
+
+// reportCartChanges 输出购物车的变化，首次获取购物车时不对比，忽略会话自身的修改
+// 通知异步发送，不阻塞获取购物车
+func (s *Session) reportCartChanges(beforeItems, beforeInvalid []Product) {
+	if beforeItems == nil && beforeInvalid == nil {
+		return
+	}
+	var changes []CartChange
+	for _, c := range DiffCart(beforeItems, beforeInvalid, s.Cart.Items, s.Cart.Invalid) {
+		// 恢复供应的商品不再受之前缺货记录的限制
+		if c.Type == CartChangeRestock {
+			s.stockout.clear(c.After.Id)
+		}
+		if !s.cartEdits.consume(c) {
+			changes = append(changes, c)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	for _, c := range changes {
+		switch c.Type {
+		case CartChangeStockout, CartChangeRemoved:
+			logrus.Warningf("购物车变化: %s", c)
+		default:
+			logrus.Infof("购物车变化: %s", c)
+		}
+	}
+	if s.onCartChange != nil {
+		go s.onCartChange(changes)
+	}
+}
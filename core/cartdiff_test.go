@@ -0,0 +1,118 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffCart(t *testing.T) {
+	ginger := Product{Id: testGingerID, Price: 459, Count: 1, StockNumber: 10}
+	garlic := Product{Id: testGarlicID, Price: 499, Count: 2, StockNumber: 10}
+	with := func(p Product, fn func(p *Product)) Product {
+		fn(&p)
+		return p
+	}
+
+	tests := []struct {
+		name                       string
+		beforeItems, beforeInvalid []Product
+		afterItems, afterInvalid   []Product
+		want                       []string
+	}{
+		{
+			name:        "没有变化",
+			beforeItems: []Product{ginger, garlic},
+			afterItems:  []Product{ginger, garlic},
+		},
+		{
+			name:        "价格和数量变化",
+			beforeItems: []Product{ginger, garlic},
+			afterItems: []Product{
+				with(ginger, func(p *Product) { p.Price = 399 }),
+				with(garlic, func(p *Product) { p.Count = 1 }),
+			},
+			want: []string{CartChangePrice + ":" + testGingerID, CartChangeCount + ":" + testGarlicID},
+		},
+		{
+			name:         "商品失效",
+			beforeItems:  []Product{ginger, garlic},
+			afterItems:   []Product{garlic},
+			afterInvalid: []Product{ginger},
+			want:         []string{CartChangeStockout + ":" + testGingerID},
+		},
+		{
+			name:        "库存售罄",
+			beforeItems: []Product{ginger},
+			afterItems:  []Product{with(ginger, func(p *Product) { p.StockNumber = 0 })},
+			want:        []string{CartChangeStockout + ":" + testGingerID},
+		},
+		{
+			name:          "恢复供应",
+			beforeItems:   []Product{garlic},
+			beforeInvalid: []Product{ginger},
+			afterItems:    []Product{garlic, ginger},
+			want:          []string{CartChangeRestock + ":" + testGingerID},
+		},
+		{
+			name:        "商品被移除",
+			beforeItems: []Product{ginger, garlic},
+			afterItems:  []Product{garlic},
+			want:        []string{CartChangeRemoved + ":" + testGingerID},
+		},
+		{
+			name:        "新增商品不作为变化",
+			beforeItems: []Product{ginger},
+			afterItems:  []Product{ginger, garlic},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range DiffCart(tt.beforeItems, tt.beforeInvalid, tt.afterItems, tt.afterInvalid) {
+				got = append(got, c.Type+":"+c.Before.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffCart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportCartChangesIgnoresOwnEdits(t *testing.T) {
+	s := NewSession("test", 0)
+	var reported []CartChange
+	done := make(chan struct{})
+	s.SetCartChangeHandler(func(changes []CartChange) {
+		reported = changes
+		close(done)
+	})
+
+	before := []Product{
+		{Id: testGingerID, Price: 459, Count: 1, StockNumber: 10},
+		{Id: testGarlicID, Price: 499, Count: 2, StockNumber: 10},
+	}
+	s.cartEdits.expect(testGingerID, 3)
+	s.Cart.Items = []Product{
+		{Id: testGingerID, Price: 459, Count: 3, StockNumber: 10},
+		{Id: testGarlicID, Price: 399, Count: 2, StockNumber: 10},
+	}
+	s.reportCartChanges(before, nil)
+	<-done
+	if len(reported) != 1 || reported[0].Type != CartChangePrice || reported[0].Before.Id != testGarlicID {
+		t.Errorf("reportCartChanges() = %v, want only the price change of %s", reported, testGarlicID)
+	}
+}
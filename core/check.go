@@ -0,0 +1,119 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+// CheckOrderResult 检查订单接口的返回结果
+type CheckOrderResult struct {
+	Success bool           `json:"success"`
+	Code    int            `json:"code"`
+	Msg     string         `json:"msg"`
+	Data    CheckOrderData `json:"data"`
+}
+
+type CheckOrderData struct {
+	Order            CheckOrderInfo `json:"order"`
+	Toast            string         `json:"toast"`
+	StockoutProducts []Product      `json:"stockout_products"`
+}
+
+type CheckOrderInfo struct {
+	TotalMoney         Money `json:"total_money"`
+	TotalOriginMoney   Money `json:"total_origin_money"`
+	GoodsRealMoney     Money `json:"goods_real_money"`
+	InstantRebateMoney Money `json:"instant_rebate_money"`
+	TotalRebateMoney   Money `json:"total_rebate_money"`
+	CouponsMoney       Money `json:"coupons_money"`
+
+	// 未返回运费时为 nil
+	FreightMoney         *Money              `json:"freight_money"`
+	FreightDiscountMoney Money               `json:"freight_discount_money"`
+	Freights             []CheckOrderFreight `json:"freights"`
+
+	UsedPointNum     int   `json:"used_point_num"`
+	UsedPointMoney   Money `json:"used_point_money"`
+	UsedBalanceMoney Money `json:"used_balance_money"`
+
+	UserTicketId    string             `json:"user_ticket_id"`
+	FreightTicketId string             `json:"freight_ticket_id"`
+	Coupons         []Coupon           `json:"coupons"`
+	Packages        []OrderProductInfo `json:"packages"`
+	Warnings        []string           `json:"warnings"`
+}
+
+type CheckOrderFreight struct {
+	Freight struct {
+		FreightMoney         Money  `json:"freight_money"`
+		FreightRealMoney     Money  `json:"freight_real_money"`
+		FreightDiscountMoney Money  `json:"discount_money"`
+		Remark               string `json:"remark"`
+	} `json:"freight"`
+}
+
+// Messages 检查订单返回的提示信息
+func (r *CheckOrderResult) Messages() []string {
+	var messages []string
+	if r.Data.Toast != "" {
+		messages = append(messages, r.Data.Toast)
+	}
+	return append(messages, r.Data.Order.Warnings...)
+}
+
+// applyCheckOrder 将检查订单结果同步到订单
+func (s *Session) applyCheckOrder(result *CheckOrderResult) {
+	order := &result.Data.Order
+	s.setOrderFreight(order)
+	s.Order.CouponMoney = order.CouponsMoney
+	s.Order.RebateMoney = order.TotalRebateMoney
+	if s.Order.RebateMoney == 0 {
+		s.Order.RebateMoney = order.InstantRebateMoney
+	}
+	s.Order.UsedPointNum = order.UsedPointNum
+	s.Order.UsedPointMoney = order.UsedPointMoney
+	s.Order.Price = order.TotalMoney
+	s.CheckOrderResult = result
+}
+
+// setOrderFreight 使用检查订单返回的运费，未返回总运费时累加各包裹的运费，均未返回时根据购物车运费和会员状态计算
+func (s *Session) setOrderFreight(order *CheckOrderInfo) {
+	// 多个包裹时各包裹分别计算运费
+	var money, realMoney, discount Money
+	for _, f := range order.Freights {
+		money += f.Freight.FreightMoney
+		realMoney += f.Freight.FreightRealMoney
+		discount += f.Freight.FreightDiscountMoney
+	}
+
+	switch {
+	case order.FreightMoney != nil:
+		s.Order.FreightMoney = *order.FreightMoney
+		s.Order.FreightDiscountMoney = order.FreightDiscountMoney
+		s.Order.FreightRealMoney = s.Order.FreightMoney - s.Order.FreightDiscountMoney
+		if len(order.Freights) > 0 {
+			s.Order.FreightRealMoney = realMoney
+		}
+	case len(order.Freights) > 0:
+		s.Order.FreightMoney = money
+		s.Order.FreightDiscountMoney = discount
+		s.Order.FreightRealMoney = realMoney
+	default:
+		freight := s.Cart.FreightMoney
+		if s.Cart.FreeFreightType == FreeFreightTypeFree || (s.User != nil && s.User.UserVip.IsVIP()) {
+			freight = 0
+		}
+		s.Order.FreightMoney = freight
+		s.Order.FreightDiscountMoney = 0
+		s.Order.FreightRealMoney = freight
+	}
+}
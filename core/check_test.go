@@ -0,0 +1,93 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import "testing"
+
+func TestSetOrderFreight(t *testing.T) {
+	freights := func(values ...[3]Money) []CheckOrderFreight {
+		result := make([]CheckOrderFreight, len(values))
+		for i, v := range values {
+			result[i].Freight.FreightMoney = v[0]
+			result[i].Freight.FreightRealMoney = v[1]
+			result[i].Freight.FreightDiscountMoney = v[2]
+		}
+		return result
+	}
+	money := func(m Money) *Money { return &m }
+
+	tests := []struct {
+		name                    string
+		order                   CheckOrderInfo
+		cartFreight             Money
+		freeFreightType         int
+		freight, real, discount Money
+	}{
+		{
+			name:     "使用订单总运费",
+			order:    CheckOrderInfo{FreightMoney: money(800), FreightDiscountMoney: 300},
+			freight:  800,
+			real:     500,
+			discount: 300,
+		},
+		{
+			name: "实付运费累加各包裹",
+			order: CheckOrderInfo{
+				FreightMoney: money(1600),
+				Freights:     freights([3]Money{800, 800, 0}, [3]Money{800, 0, 800}),
+			},
+			freight: 1600,
+			real:    800,
+		},
+		{
+			name:     "未返回总运费时累加各包裹",
+			order:    CheckOrderInfo{Freights: freights([3]Money{800, 500, 300}, [3]Money{600, 600, 0})},
+			freight:  1400,
+			real:     1100,
+			discount: 300,
+		},
+		{
+			name:        "未返回运费时使用购物车运费",
+			cartFreight: 800,
+			freight:     800,
+			real:        800,
+		},
+		{
+			name:            "购物车免运费",
+			cartFreight:     800,
+			freeFreightType: FreeFreightTypeFree,
+		},
+		{
+			name:            "未知的免运费类型按购物车运费计算",
+			cartFreight:     800,
+			freeFreightType: 1,
+			freight:         800,
+			real:            800,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("test", 0)
+			s.Cart.FreightMoney = tt.cartFreight
+			s.Cart.FreeFreightType = tt.freeFreightType
+			s.setOrderFreight(&tt.order)
+			if s.Order.FreightMoney != tt.freight || s.Order.FreightRealMoney != tt.real || s.Order.FreightDiscountMoney != tt.discount {
+				t.Errorf("setOrderFreight() = %s, %s, %s, want %s, %s, %s",
+					s.Order.FreightMoney, s.Order.FreightRealMoney, s.Order.FreightDiscountMoney,
+					tt.freight, tt.real, tt.discount)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 商品优惠券
+	CouponTypeGoods = 1
+	// 运费券
+	CouponTypeFreight = 2
+)
+
+type CouponResult struct {
+	Success bool   `json:"success"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Data    struct {
+		List []json.RawMessage `json:"list"`
+	} `json:"data"`
+}
+
+type Coupon struct {
+	Id             string `json:"id"`
+	Name           string `json:"name"`
+	Type           int    `json:"coupon_type"`
+	Money          Money  `json:"money"`
+	ConditionMoney Money  `json:"condition_money"`
+	StartTime      int64  `json:"start_time"`
+	EndTime        int64  `json:"end_time"`
+}
+
+func (c Coupon) String() string {
+	if c.Name == "" {
+		return c.Id
+	}
+	if c.ConditionMoney > 0 {
+		return fmt.Sprintf("%s(满%s减%s)", c.Name, c.ConditionMoney, c.Money)
+	}
+	return fmt.Sprintf("%s(减%s)", c.Name, c.Money)
+}
+
+// valid 优惠券在指定时间是否处于有效期内，未返回有效期时视为有效
+func (c Coupon) valid(now time.Time) bool {
+	if c.StartTime > 0 && now.Unix() < c.StartTime {
+		return false
+	}
+	if c.EndTime > 0 && now.Unix() > c.EndTime {
+		return false
+	}
+	return true
+}
+
+// discount 优惠券在当前订单上可抵扣的金额，不可用时返回 0
+func (c Coupon) discount(goods, freight Money) Money {
+	if goods < c.ConditionMoney {
+		return 0
+	}
+	switch c.Type {
+	case CouponTypeGoods:
+		if c.Money > goods {
+			return goods
+		}
+		return c.Money
+	case CouponTypeFreight:
+		if c.Money > freight {
+			return freight
+		}
+		return c.Money
+	}
+	return 0
+}
+
+// CouponPolicy 优惠券使用策略
+type CouponPolicy struct {
+	// 自动选择抵扣金额最大的优惠券和运费券
+	Auto bool `yaml:"auto"`
+	// 指定优惠券ID，优先于自动选择
+	UserTicketID string `yaml:"user_ticket_id"`
+	// 指定运费券ID，优先于自动选择
+	FreightTicketID string `yaml:"freight_ticket_id"`
+	// 优惠券和运费券不能同时使用，只使用抵扣金额最大的一张
+	NoStack bool `yaml:"no_stack"`
+}
+
+// GetCoupons 获取当前账号未使用的优惠券和运费券
+// 优惠券接口及字段未经验证，无法解析的优惠券会被忽略
+func (s *Session) GetCoupons() ([]Coupon, error) {
+	u, err := url.Parse("https://maicai.api.ddxq.mobi/coupon/getCouponList")
+	if err != nil {
+		return nil, fmt.Errorf("coupon url parse failed: %v", err)
+	}
+
+	params := s.buildURLParams(true)
+	params.Set("status", "0")
+	u.RawQuery = params.Encode()
+	urlPath := u.String()
+
+	req := s.client.R()
+	req.Header = s.buildHeader()
+	resp, err := s.execute(context.Background(), req, http.MethodGet, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var couponResult CouponResult
+	if err := json.Unmarshal(resp.Body(), &couponResult); err != nil {
+		return nil, fmt.Errorf("parse response failed: %v, body: %v", err, resp.String())
+	}
+	coupons := make([]Coupon, 0, len(couponResult.Data.List))
+	for _, raw := range couponResult.Data.List {
+		var c Coupon
+		if err := json.Unmarshal(raw, &c); err != nil || c.Id == "" {
+			logrus.Warningf("忽略无法解析的优惠券: %s", raw)
+			continue
+		}
+		coupons = append(coupons, c)
+	}
+	return coupons, nil
+}
+
+// LoadCoupons 按策略加载可用的优惠券，未配置策略时不请求
+func (s *Session) LoadCoupons() error {
+	if !s.CouponPolicy.Auto && s.CouponPolicy.UserTicketID == "" && s.CouponPolicy.FreightTicketID == "" {
+		return nil
+	}
+	// 获取失败时不自动选择优惠券，指定的券依旧由服务端校验，不影响下单
+	s.Coupons = nil
+	coupons, err := s.GetCoupons()
+	if err != nil {
+		return err
+	}
+	s.Coupons = coupons
+	return nil
+}
+
+// SelectCoupons 根据当前订单金额选择优惠券，结果记录在订单中
+// 优惠券和运费券作为组合选择，运费券的使用门槛按扣除优惠券后的商品金额计算
+func (s *Session) SelectCoupons() {
+	var goods Money
+	for _, p := range s.Order.Products {
+		goods += p.TotalPrice
+	}
+	freight := s.Order.FreightMoney
+	if freight == 0 {
+		freight = s.Cart.FreightMoney
+	}
+
+	now := time.Now()
+	userTickets := s.couponCandidates(CouponTypeGoods, s.CouponPolicy.UserTicketID, now)
+	freightTickets := s.couponCandidates(CouponTypeFreight, s.CouponPolicy.FreightTicketID, now)
+	var bestUser, bestFreight *Coupon
+	bestDiscount := Money(-1)
+	for _, u := range userTickets {
+		for _, f := range freightTickets {
+			if s.CouponPolicy.NoStack && u != nil && f != nil {
+				continue
+			}
+			var discount Money
+			if u != nil {
+				discount += u.discount(goods, freight)
+			}
+			if f != nil {
+				discount += f.discount(goods-discount, freight)
+			}
+			if discount > bestDiscount {
+				bestUser, bestFreight, bestDiscount = u, f, discount
+			}
+		}
+	}
+	if bestDiscount < 0 {
+		// 同时指定了优惠券和运费券但不能同时使用时，使用优惠券
+		bestUser = userTickets[0]
+	}
+	s.Order.UserTicket = bestUser
+	s.Order.FreightTicket = bestFreight
+}
+
+// couponCandidates 可选的优惠券，nil 表示不使用，指定ID时只能使用指定的券
+func (s *Session) couponCandidates(couponType int, id string, now time.Time) []*Coupon {
+	if id != "" {
+		for i := range s.Coupons {
+			c := &s.Coupons[i]
+			if c.Id != id {
+				continue
+			}
+			if !c.valid(now) {
+				logrus.Warningf("指定的优惠券(%s)不在有效期内，不使用", c)
+				return []*Coupon{nil}
+			}
+			return []*Coupon{c}
+		}
+		// 未在列表中找到时依旧使用指定的ID，由服务端校验
+		return []*Coupon{{Id: id, Type: couponType}}
+	}
+	candidates := []*Coupon{nil}
+	if !s.CouponPolicy.Auto {
+		return candidates
+	}
+	for i := range s.Coupons {
+		c := &s.Coupons[i]
+		if c.Type == couponType && c.valid(now) {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+func ticketID(c *Coupon) string {
+	if c == nil {
+		return "default"
+	}
+	return c.Id
+}
+
+func couponsID(coupons ...*Coupon) string {
+	ids := make([]string, 0, len(coupons))
+	for _, c := range coupons {
+		if c != nil {
+			ids = append(ids, c.Id)
+		}
+	}
+	return strings.Join(ids, ",")
+}
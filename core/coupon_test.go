@@ -0,0 +1,123 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectCoupons(t *testing.T) {
+	now := time.Now().Unix()
+	coupons := []Coupon{
+		{Id: "goods-5", Type: CouponTypeGoods, Money: 500, ConditionMoney: 3000},
+		{Id: "goods-10", Type: CouponTypeGoods, Money: 1000, ConditionMoney: 8000},
+		{Id: "freight-8", Type: CouponTypeFreight, Money: 800},
+		// 满减后商品金额不足时无法使用
+		{Id: "freight-full", Type: CouponTypeFreight, Money: 800, ConditionMoney: 3500},
+		{Id: "expired", Type: CouponTypeGoods, Money: 2000, EndTime: now - 60},
+	}
+
+	tests := []struct {
+		name        string
+		policy      CouponPolicy
+		goods       Money
+		wantUser    string
+		wantFreight string
+	}{
+		{
+			name:        "自动选择优惠券和运费券",
+			policy:      CouponPolicy{Auto: true},
+			goods:       3600,
+			wantUser:    "goods-5",
+			wantFreight: "freight-8",
+		},
+		{
+			name:   "不满足门槛时不使用",
+			policy: CouponPolicy{Auto: true},
+			goods:  1000,
+			// 运费券无门槛
+			wantFreight: "freight-8",
+		},
+		{
+			name:     "不能叠加时选择抵扣最多的一张",
+			policy:   CouponPolicy{Auto: true, NoStack: true},
+			goods:    9000,
+			wantUser: "goods-10",
+		},
+		{
+			name:        "指定的优惠券优先",
+			policy:      CouponPolicy{Auto: true, UserTicketID: "goods-5"},
+			goods:       9000,
+			wantUser:    "goods-5",
+			wantFreight: "freight-8",
+		},
+		{
+			name:     "指定不在列表中的券时依旧使用",
+			policy:   CouponPolicy{UserTicketID: "unknown"},
+			goods:    9000,
+			wantUser: "unknown",
+		},
+		{
+			name:   "指定过期的券时不使用",
+			policy: CouponPolicy{UserTicketID: "expired"},
+			goods:  9000,
+		},
+		{
+			name:   "未开启自动选择",
+			goods:  9000,
+			policy: CouponPolicy{},
+		},
+	}
+	id := func(c *Coupon) string {
+		if c == nil {
+			return ""
+		}
+		return c.Id
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("test", 0)
+			s.Coupons = coupons
+			s.CouponPolicy = tt.policy
+			s.Order.Products = []Product{{TotalPrice: tt.goods}}
+			s.Order.FreightMoney = 800
+			s.SelectCoupons()
+			if got := id(s.Order.UserTicket); got != tt.wantUser {
+				t.Errorf("SelectCoupons() user ticket = %q, want %q", got, tt.wantUser)
+			}
+			if got := id(s.Order.FreightTicket); got != tt.wantFreight {
+				t.Errorf("SelectCoupons() freight ticket = %q, want %q", got, tt.wantFreight)
+			}
+		})
+	}
+}
+
+func TestGetCouponsSkipsInvalid(t *testing.T) {
+	s := NewSession("test", 0)
+	s.Address = &AddressItem{}
+	s.client.SetTransport(stubTransport(`{"success":true,"code":0,"data":{"list":[
+		{"id":"goods-5","coupon_type":1,"money":"5.00","condition_money":"30"},
+		{"id":"broken","coupon_type":1,"money":"五元"},
+		{"coupon_type":2,"money":"8"}
+	]}}`))
+	coupons, err := s.GetCoupons()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coupons) != 1 || coupons[0].Id != "goods-5" || coupons[0].Money != 500 {
+		t.Errorf("GetCoupons() = %+v, want only goods-5", coupons)
+	}
+}
@@ -27,4 +27,5 @@ const (
 	ErrOperator         = Error("操作失败")
 	ErrMethodNotAllowed = Error("405 MethodNotAllowed")
 	ErrCapacityFull     = Error("由于近期疫情问题，配送运力紧张，本站点当前运力已约满")
+	ErrOverPriceLimit   = Error("订单金额超出上限")
 )
@@ -0,0 +1,215 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// 免运费提示中的门槛金额，例如“满39元免配送费”
+	freeFreightThresholdRe = regexp.MustCompile(`满\s*(\d+(?:\.\d+)?)\s*元`)
+	// 免运费提示中的差额，例如“还差10.5元免配送费”
+	freeFreightGapRe = regexp.MustCompile(`差\s*(\d+(?:\.\d+)?)\s*元`)
+)
+
+// FillerSuggestion 免运费凑单建议
+type FillerSuggestion struct {
+	Gap      Money
+	Total    Money
+	Products []Product
+}
+
+func (f *FillerSuggestion) String() string {
+	items := make([]string, 0, len(f.Products))
+	for _, p := range f.Products {
+		items = append(items, fmt.Sprintf("%s x%d(%s)", p.ProductName, p.Count, p.TotalPrice))
+	}
+	return fmt.Sprintf("距免运费差 %s，建议凑单 %s: %s", f.Gap, f.Total, strings.Join(items, ", "))
+}
+
+// freeFreightNotices 购物车响应中与免运费相关的提示文本
+func freeFreightNotices(data *ProductData) []string {
+	notices := []string{data.CartNotice, data.CartNoticeNew}
+	var walk func(r gjson.Result)
+	walk = func(r gjson.Result) {
+		switch {
+		case r.Type == gjson.String:
+			notices = append(notices, r.Str)
+		case r.IsObject() || r.IsArray():
+			r.ForEach(func(_, v gjson.Result) bool {
+				walk(v)
+				return true
+			})
+		}
+	}
+	if len(data.FreeFreightNotice) > 0 {
+		walk(gjson.ParseBytes(data.FreeFreightNotice))
+	}
+	return notices
+}
+
+// parseFreeFreightThreshold 从免运费提示中解析免运费门槛，无法解析时返回 0
+// 提示的格式未经验证，只识别“满X元”以及“差X元”(门槛为购物车金额加差额)
+func parseFreeFreightThreshold(total Money, notices ...string) Money {
+	for _, notice := range notices {
+		if m := freeFreightThresholdRe.FindStringSubmatch(notice); m != nil {
+			if threshold, err := ParseMoney(m[1]); err == nil && threshold > 0 {
+				return threshold
+			}
+		}
+	}
+	for _, notice := range notices {
+		if m := freeFreightGapRe.FindStringSubmatch(notice); m != nil {
+			if gap, err := ParseMoney(m[1]); err == nil && gap > 0 {
+				return total + gap
+			}
+		}
+	}
+	return 0
+}
+
+// FreeFreightThreshold 免运费门槛，配置的门槛大于 0 时优先使用，否则使用购物车提示中的门槛
+func (s *Session) FreeFreightThreshold(override Money) Money {
+	if override > 0 {
+		return override
+	}
+	return s.Cart.FreeFreightThreshold
+}
+
+// FreeFreightGap 当前购物车距离免运费门槛的差额，已免运费时返回 0
+func (s *Session) FreeFreightGap(threshold Money) Money {
+	if s.Cart.FreightMoney <= 0 || s.Cart.TotalMoney >= threshold {
+		return 0
+	}
+	return threshold - s.Cart.TotalMoney
+}
+
+// SuggestFiller 从候选商品中挑选补齐差额且总价最低的凑单组合，没有差额时返回 nil
+func (s *Session) SuggestFiller(threshold Money, ids []string) (*FillerSuggestion, error) {
+	gap := s.FreeFreightGap(threshold)
+	if gap <= 0 {
+		return nil, nil
+	}
+
+	candidates := make([]Product, 0, len(ids))
+	for _, id := range ids {
+		product, err := s.GetProduct(id)
+		if err != nil {
+			logrus.Warningf("获取凑单商品(%s)失败: %v", id, err)
+			continue
+		}
+		if !product.Available() || product.Price <= 0 {
+			continue
+		}
+		candidates = append(candidates, *product)
+	}
+	products := cheapestCover(gap, candidates)
+	if len(products) == 0 {
+		return nil, fmt.Errorf("没有可用于凑单的商品")
+	}
+
+	suggestion := &FillerSuggestion{Gap: gap, Products: products}
+	for _, p := range products {
+		suggestion.Total += p.TotalPrice
+	}
+	return suggestion, nil
+}
+
+// ApplyFiller 将凑单商品加入购物车，凑单商品不受勾选规则影响
+func (s *Session) ApplyFiller(suggestion *FillerSuggestion) error {
+	for _, p := range suggestion.Products {
+		if err := s.AddCart(p.Id, p.Count); err != nil {
+			return fmt.Errorf("添加凑单商品(%s)失败: %v", p.ProductName, err)
+		}
+		s.added.add(p.Id)
+	}
+	return s.GetCart()
+}
+
+// cheapestCover 计算总价不低于 gap 的最便宜商品组合，每件商品的数量受库存和限购约束
+func cheapestCover(gap Money, candidates []Product) []Product {
+	type unit struct {
+		index int
+		price Money
+	}
+	var units []unit
+	var maxPrice Money
+	for i, p := range candidates {
+		// 单件商品最多需要 gap/price 向上取整件
+		limit := int((gap + p.Price - 1) / p.Price)
+		if p.StockNumber < limit {
+			limit = p.StockNumber
+		}
+		if p.BuyLimit > 0 && p.BuyLimit < limit {
+			limit = p.BuyLimit
+		}
+		for n := 0; n < limit; n++ {
+			units = append(units, unit{index: i, price: p.Price})
+		}
+		if p.Price > maxPrice {
+			maxPrice = p.Price
+		}
+	}
+	if len(units) == 0 {
+		return nil
+	}
+
+	// 0-1 背包求可达金额，超出 gap 的部分不会超过单件最高价
+	size := int(gap + maxPrice)
+	prev := make([]int, size+1)
+	for i := range prev {
+		prev[i] = -1
+	}
+	prev[0] = len(units)
+	for u, item := range units {
+		for sum := size; sum >= int(item.price); sum-- {
+			if prev[sum] == -1 && prev[sum-int(item.price)] != -1 {
+				prev[sum] = u
+			}
+		}
+	}
+
+	best := -1
+	for sum := int(gap); sum <= size; sum++ {
+		if prev[sum] != -1 {
+			best = sum
+			break
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+
+	counts := make(map[int]int)
+	for sum := best; sum > 0; sum -= int(units[prev[sum]].price) {
+		counts[units[prev[sum]].index]++
+	}
+	var result []Product
+	for i, p := range candidates {
+		if counts[i] == 0 {
+			continue
+		}
+		p.Count = counts[i]
+		p.TotalPrice = p.Price.Mul(p.Count)
+		result = append(result, p)
+	}
+	return result
+}
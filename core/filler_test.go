@@ -0,0 +1,59 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFreeFreightThreshold(t *testing.T) {
+	tests := []struct {
+		name   string
+		notice string
+		cart   string
+		want   Money
+	}{
+		{name: "已免运费", cart: "已免配送费", notice: `{}`},
+		{name: "门槛金额", cart: "满39元免配送费", want: 3900},
+		{name: "差额", cart: "还差10.5元免配送费", want: 2008},
+		{name: "免运费提示中的门槛", notice: `{"text":"满 49.9 元免运费","sub":{"tips":["差40.32元"]}}`, want: 4990},
+		{name: "免运费提示中的差额", notice: `{"tips":["还差 0.42 元免运费"]}`, want: 1000},
+		{name: "无法解析", cart: "配送费5元", notice: `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &ProductData{CartNotice: tt.cart, FreeFreightNotice: json.RawMessage(tt.notice)}
+			if got := parseFreeFreightThreshold(958, freeFreightNotices(data)...); got != tt.want {
+				t.Errorf("parseFreeFreightThreshold() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeFreightThreshold(t *testing.T) {
+	s := testCartSession(t)
+	// 示例购物车已免运费，没有门槛提示
+	if got := s.FreeFreightThreshold(0); got != 0 {
+		t.Errorf("FreeFreightThreshold(0) = %s, want 0", got)
+	}
+	s.Cart.FreeFreightThreshold = 3900
+	if got := s.FreeFreightThreshold(0); got != 3900 {
+		t.Errorf("FreeFreightThreshold(0) = %s, want 39.00", got)
+	}
+	if got := s.FreeFreightThreshold(4900); got != 4900 {
+		t.Errorf("FreeFreightThreshold(49) = %s, want 49.00", got)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	SourceCart    = "cart"
+	SourceProduct = "product"
+)
+
+var historyBucket = []byte("products")
+
+// Observation 一次观察到的商品价格和库存
+type Observation struct {
+	Time          time.Time `json:"time"`
+	ProductId     string    `json:"product_id"`
+	ProductName   string    `json:"product_name"`
+	Price         Money     `json:"price"`
+	OriginPrice   Money     `json:"origin_price"`
+	StockNumber   int       `json:"stock_number"`
+	TodayStockout string    `json:"today_stockout"`
+	Available     bool      `json:"available"`
+	// 观察来源: cart 购物车，product 商品查询
+	Source string `json:"source"`
+}
+
+func newObservation(p Product, source string, now time.Time) Observation {
+	return Observation{
+		Time:          now,
+		ProductId:     p.Id,
+		ProductName:   p.ProductName,
+		Price:         p.Price,
+		OriginPrice:   p.OriginPrice,
+		StockNumber:   p.StockNumber,
+		TodayStockout: p.TodayStockout,
+		Available:     p.Available(),
+		Source:        source,
+	}
+}
+
+// changed 价格或库存状态是否与上一次不同
+func (o Observation) changed(last Observation) bool {
+	return o.Price != last.Price ||
+		o.OriginPrice != last.OriginPrice ||
+		o.StockNumber != last.StockNumber ||
+		o.TodayStockout != last.TodayStockout
+}
+
+// PriceDrop 商品降价记录
+type PriceDrop struct {
+	Before Observation
+	After  Observation
+}
+
+func (d PriceDrop) String() string {
+	return fmt.Sprintf("%s 降价: %s -> %s", d.After.ProductName, d.Before.Price, d.After.Price)
+}
+
+// HistoryStore 本地的商品价格和库存记录，仅在发生变化时记录
+// 记录文件同一时间只能被一个进程打开，运行中的 ddshop 会一直占用
+type HistoryStore struct {
+	db *bolt.DB
+
+	mu sync.Mutex
+	// 各商品最近一次记录，未变化时不写入文件
+	last map[string]Observation
+}
+
+// OpenHistoryStore 打开记录文件，不存在时创建
+func OpenHistoryStore(path string) (*HistoryStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("记录文件(%s)正在被其他 ddshop 进程使用，请在其退出后重试", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开记录文件(%s)失败: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("初始化记录文件失败: %v", err)
+	}
+	return &HistoryStore{db: db, last: make(map[string]Observation)}, nil
+}
+
+func (h *HistoryStore) Close() error {
+	return h.db.Close()
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// Record 记录价格或库存发生变化的商品，返回降价的商品
+// 先与内存中最近一次记录对比，没有变化时不开启写事务
+func (h *HistoryStore) Record(observations ...Observation) ([]PriceDrop, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.loadLast(observations); err != nil {
+		return nil, err
+	}
+
+	var drops []PriceDrop
+	var changed []Observation
+	pending := make(map[string]Observation)
+	for _, o := range observations {
+		last, ok := pending[o.ProductId]
+		if !ok {
+			last, ok = h.last[o.ProductId]
+		}
+		if ok {
+			if !o.changed(last) {
+				continue
+			}
+			if o.Price < last.Price {
+				drops = append(drops, PriceDrop{Before: last, After: o})
+			}
+		}
+		pending[o.ProductId] = o
+		changed = append(changed, o)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(historyBucket)
+		for _, o := range changed {
+			bucket, err := root.CreateBucketIfNotExists([]byte(o.ProductId))
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(o)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(timeKey(o.Time), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, o := range pending {
+		h.last[id] = o
+	}
+	return drops, nil
+}
+
+// loadLast 从文件中读取内存中没有的商品最近一次记录
+func (h *HistoryStore) loadLast(observations []Observation) error {
+	var missing []string
+	for _, o := range observations {
+		if _, ok := h.last[o.ProductId]; !ok {
+			missing = append(missing, o.ProductId)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return h.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(historyBucket)
+		for _, id := range missing {
+			bucket := root.Bucket([]byte(id))
+			if bucket == nil {
+				continue
+			}
+			_, v := bucket.Cursor().Last()
+			if v == nil {
+				continue
+			}
+			var last Observation
+			if err := json.Unmarshal(v, &last); err != nil {
+				return err
+			}
+			h.last[id] = last
+		}
+		return nil
+	})
+}
+
+// Product 商品的历史记录，按时间排序，limit 大于 0 时只返回最近的记录
+func (h *HistoryStore) Product(id string, limit int) ([]Observation, error) {
+	var result []Observation
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+			var o Observation
+			if err := json.Unmarshal(v, &o); err != nil {
+				return err
+			}
+			result = append(result, o)
+		}
+		return nil
+	})
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, err
+}
+
+// SetHistory 设置记录商品价格和库存的存储，watch 中的商品降价时调用 onDrop
+func (s *Session) SetHistory(store *HistoryStore, watch []string, onDrop func(PriceDrop)) {
+	s.history = store
+	s.watchPrices = make(map[string]struct{}, len(watch))
+	for _, id := range watch {
+		s.watchPrices[id] = struct{}{}
+	}
+	s.onPriceDrop = onDrop
+}
+
+// observe 记录商品价格和库存，记录失败不影响主流程，降价通知异步发送
+func (s *Session) observe(source string, products ...Product) {
+	if s.history == nil || len(products) == 0 {
+		return
+	}
+	now := time.Now()
+	observations := make([]Observation, 0, len(products))
+	for _, p := range products {
+		observations = append(observations, newObservation(p, source, now))
+	}
+	drops, err := s.history.Record(observations...)
+	if err != nil {
+		logrus.Warningf("记录商品价格失败: %v", err)
+		return
+	}
+	for _, d := range drops {
+		if _, ok := s.watchPrices[d.After.ProductId]; !ok {
+			continue
+		}
+		logrus.Info(d.String())
+		if s.onPriceDrop != nil {
+			go s.onPriceDrop(d)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreRecord(t *testing.T) {
+	start := time.Unix(1650000000, 0)
+	observe := func(minute int, price Money, stock int) Observation {
+		return Observation{
+			Time:        start.Add(time.Duration(minute) * time.Minute),
+			ProductId:   testGingerID,
+			ProductName: "生姜 约300g",
+			Price:       price,
+			StockNumber: stock,
+			Available:   stock > 0,
+			Source:      SourceCart,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		batches     [][]Observation
+		wantRecords int
+		wantDrops   int
+	}{
+		{
+			name:        "首次记录",
+			batches:     [][]Observation{{observe(0, 459, 10)}},
+			wantRecords: 1,
+		},
+		{
+			name:        "未变化时不记录",
+			batches:     [][]Observation{{observe(0, 459, 10)}, {observe(1, 459, 10)}},
+			wantRecords: 1,
+		},
+		{
+			name:        "降价",
+			batches:     [][]Observation{{observe(0, 459, 10)}, {observe(1, 399, 10)}},
+			wantRecords: 2,
+			wantDrops:   1,
+		},
+		{
+			name:        "涨价和库存变化",
+			batches:     [][]Observation{{observe(0, 459, 10)}, {observe(1, 499, 10)}, {observe(2, 499, 0)}},
+			wantRecords: 3,
+		},
+		{
+			name:        "同一批次中的多次观察",
+			batches:     [][]Observation{{observe(0, 459, 10), observe(1, 459, 10), observe(2, 399, 10)}},
+			wantRecords: 2,
+			wantDrops:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := OpenHistoryStore(filepath.Join(t.TempDir(), "history.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			var drops int
+			for _, batch := range tt.batches {
+				d, err := store.Record(batch...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				drops += len(d)
+			}
+			records, err := store.Product(testGingerID, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.wantRecords || drops != tt.wantDrops {
+				t.Errorf("Record() records = %d, drops = %d, want %d, %d", len(records), drops, tt.wantRecords, tt.wantDrops)
+			}
+		})
+	}
+}
+
+func TestHistoryStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	first := Observation{Time: time.Unix(1650000000, 0), ProductId: testGingerID, Price: 459, StockNumber: 10}
+	store, err := OpenHistoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Record(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后与文件中的最近一次记录对比
+	store, err = OpenHistoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	second := first
+	second.Time = first.Time.Add(time.Minute)
+	second.Price = 399
+	drops, err := store.Record(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drops) != 1 || drops[0].Before.Price != 459 {
+		t.Errorf("Record() drops = %v, want one drop from 4.59", drops)
+	}
+}
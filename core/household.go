@@ -0,0 +1,255 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 订单中不属于任何成员的商品
+const unassignedMember = "未分配"
+
+// Attribution 商品ID对应的各成员需要的数量
+type Attribution map[string]map[string]int
+
+func (i ShoppingItem) key() string {
+	if i.ID != "" {
+		return "id:" + i.ID
+	}
+	return "search:" + strings.TrimSpace(i.Search)
+}
+
+// members 清单商品各成员需要的数量，未记录成员时归属于清单的成员
+func (i ShoppingItem) members(member string) map[string]int {
+	if len(i.Members) > 0 {
+		return i.Members
+	}
+	count := i.Count
+	if count <= 0 {
+		count = 1
+	}
+	if member == "" {
+		member = unassignedMember
+	}
+	return map[string]int{member: count}
+}
+
+// MergeShoppingLists 合并多个成员的购物清单，数量相加并记录各成员需要的数量
+// 规格不同时使用第一个指定的规格，单价上限取最低值，返回冲突说明
+func MergeShoppingLists(lists []*ShoppingList) (*ShoppingList, []string) {
+	merged := &ShoppingList{}
+	var conflicts []string
+	index := make(map[string]int)
+	for _, list := range lists {
+		merged.KeepOthers = merged.KeepOthers || list.KeepOthers
+		for _, item := range list.Items {
+			members := item.members(list.Member)
+			i, ok := index[item.key()]
+			if !ok {
+				item.Members = make(map[string]int, len(members))
+				item.Count = 0
+				index[item.key()] = len(merged.Items)
+				merged.Items = append(merged.Items, item)
+				i = len(merged.Items) - 1
+			} else {
+				target := &merged.Items[i]
+				if item.Size != "" && target.Size != "" && item.Size != target.Size {
+					conflicts = append(conflicts, fmt.Sprintf("%s 规格冲突: %s(保留) / %s(%s)",
+						item, target.Size, item.Size, list.Member))
+				} else if target.Size == "" {
+					target.Size = item.Size
+				}
+				if item.MaxPrice > 0 && (target.MaxPrice == 0 || item.MaxPrice < target.MaxPrice) {
+					if target.MaxPrice > 0 {
+						conflicts = append(conflicts, fmt.Sprintf("%s 单价上限冲突: 使用较低的 %s(%s)",
+							item, item.MaxPrice, list.Member))
+					}
+					target.MaxPrice = item.MaxPrice
+				}
+			}
+
+			target := &merged.Items[i]
+			for member, count := range members {
+				target.Members[member] += count
+				target.Count += count
+			}
+		}
+	}
+	return merged, conflicts
+}
+
+// Attribution 同步后各商品对应的成员需要的数量，仅包括已匹配到商品的清单项
+func (l *ShoppingList) Attribution() Attribution {
+	result := make(Attribution)
+	for _, item := range l.Items {
+		if item.productId == "" {
+			continue
+		}
+		if result[item.productId] == nil {
+			result[item.productId] = make(map[string]int)
+		}
+		for member, count := range item.members(l.Member) {
+			result[item.productId][member] += count
+		}
+	}
+	return result
+}
+
+// MemberCost 成员分摊的订单金额
+type MemberCost struct {
+	Member string
+	// 商品金额
+	Goods Money
+	// 按商品金额比例分摊运费和优惠后的金额
+	Total    Money
+	Products []string
+}
+
+func (c MemberCost) String() string {
+	return fmt.Sprintf("%s: %s(商品 %s，%s)", c.Member, c.Total, c.Goods, strings.Join(c.Products, "、"))
+}
+
+// splitMoney 按权重分摊金额，余数计入最后一项
+func splitMoney(total Money, weights []int64) []Money {
+	result := make([]Money, len(weights))
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		return result
+	}
+	var assigned Money
+	for i, w := range weights {
+		result[i] = Money(int64(total) * w / sum)
+		assigned += result[i]
+	}
+	result[len(result)-1] += total - assigned
+	return result
+}
+
+// splitCount 按权重分配数量，余数按比例的小数部分从大到小分配，相同时优先分配给靠前的项
+func splitCount(total int, weights []int) []int {
+	result := make([]int, len(weights))
+	var sum int
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		return result
+	}
+	var assigned int
+	remainders := make([]int, len(weights))
+	order := make([]int, len(weights))
+	for i, w := range weights {
+		result[i] = total * w / sum
+		remainders[i] = total * w % sum
+		assigned += result[i]
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; assigned < total; i++ {
+		result[order[i]]++
+		assigned++
+	}
+	return result
+}
+
+// orderedMembers 订单中商品实际下单数量在各成员间的分配，按成员需要的数量比例分配
+// 替代商品沿用被替代商品的成员
+func orderedMembers(p Product, attribution Attribution, substitutions []Substitution) ([]string, []int) {
+	members := attribution[p.Id]
+	if len(members) == 0 {
+		for _, sub := range substitutions {
+			if sub.To.Id == p.Id && len(attribution[sub.From.Id]) > 0 {
+				members = attribution[sub.From.Id]
+				break
+			}
+		}
+	}
+	if len(members) == 0 {
+		return []string{unassignedMember}, []int{p.Count}
+	}
+
+	names := make([]string, 0, len(members))
+	for member := range members {
+		names = append(names, member)
+	}
+	sort.Strings(names)
+	requested := make([]int, 0, len(names))
+	for _, member := range names {
+		requested = append(requested, members[member])
+	}
+
+	var resultNames []string
+	var counts []int
+	for i, count := range splitCount(p.Count, requested) {
+		if count > 0 {
+			resultNames = append(resultNames, names[i])
+			counts = append(counts, count)
+		}
+	}
+	return resultNames, counts
+}
+
+// SplitCost 按订单中商品的最终金额和实际下单数量分摊订单金额
+// 实际下单数量按成员需要的数量比例分配，商品金额按分配的数量分摊，运费和优惠按成员商品金额的比例分摊
+func SplitCost(result *CreateOrderResult, attribution Attribution) []MemberCost {
+	costs := make(map[string]*MemberCost)
+	cost := func(member string) *MemberCost {
+		c, ok := costs[member]
+		if !ok {
+			c = &MemberCost{Member: member}
+			costs[member] = c
+		}
+		return c
+	}
+
+	var goods Money
+	for _, p := range result.Order.Products {
+		goods += p.TotalPrice
+		names, counts := orderedMembers(p, attribution, result.Order.Substitutions)
+		weights := make([]int64, 0, len(counts))
+		for _, count := range counts {
+			weights = append(weights, int64(count))
+		}
+		for i, share := range splitMoney(p.TotalPrice, weights) {
+			c := cost(names[i])
+			c.Goods += share
+			c.Products = append(c.Products, fmt.Sprintf("%s x%d", p.ProductName, counts[i]))
+		}
+	}
+
+	list := make([]MemberCost, 0, len(costs))
+	for _, c := range costs {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Member < list[j].Member
+	})
+	weights := make([]int64, 0, len(list))
+	for _, c := range list {
+		weights = append(weights, int64(c.Goods))
+	}
+	extras := splitMoney(result.Price-goods, weights)
+	for i := range list {
+		list[i].Total = list[i].Goods + extras[i]
+	}
+	return list
+}
@@ -0,0 +1,113 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		weights []int
+		want    []int
+	}{
+		{name: "整除", total: 4, weights: []int{1, 3}, want: []int{1, 3}},
+		{name: "余数优先分配给小数部分大的项", total: 3, weights: []int{1, 2}, want: []int{1, 2}},
+		{name: "数量少于成员", total: 2, weights: []int{1, 1, 1}, want: []int{1, 1, 0}},
+		{name: "下单数量少于需要的数量", total: 3, weights: []int{2, 2}, want: []int{2, 1}},
+		{name: "权重为 0", total: 3, weights: []int{0, 0}, want: []int{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitCount(tt.total, tt.weights); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCost(t *testing.T) {
+	ginger := Product{Id: testGingerID, ProductName: "生姜", Price: 459}
+	garlic := Product{Id: testGarlicID, ProductName: "蒜头", Price: 499}
+	ordered := func(p Product, count int) Product {
+		p.Count = count
+		p.TotalPrice = p.Price.Mul(count)
+		return p
+	}
+
+	tests := []struct {
+		name          string
+		products      []Product
+		substitutions []Substitution
+		price         Money
+		attribution   Attribution
+		want          []MemberCost
+	}{
+		{
+			name:        "按成员需要的数量分摊",
+			products:    []Product{ordered(ginger, 2), ordered(garlic, 1)},
+			price:       1417,
+			attribution: Attribution{testGingerID: {"alice": 1, "bob": 1}, testGarlicID: {"bob": 1}},
+			want: []MemberCost{
+				{Member: "alice", Goods: 459, Total: 459, Products: []string{"生姜 x1"}},
+				{Member: "bob", Goods: 958, Total: 958, Products: []string{"生姜 x1", "蒜头 x1"}},
+			},
+		},
+		{
+			name:        "缺货时按实际下单数量分摊",
+			products:    []Product{ordered(ginger, 3)},
+			price:       1377,
+			attribution: Attribution{testGingerID: {"alice": 2, "bob": 2}},
+			want: []MemberCost{
+				{Member: "alice", Goods: 918, Total: 918, Products: []string{"生姜 x2"}},
+				{Member: "bob", Goods: 459, Total: 459, Products: []string{"生姜 x1"}},
+			},
+		},
+		{
+			name:          "替代商品沿用被替代商品的成员",
+			products:      []Product{ordered(garlic, 2)},
+			substitutions: []Substitution{{From: ginger, To: garlic}},
+			price:         998,
+			attribution:   Attribution{testGingerID: {"alice": 2}},
+			want: []MemberCost{
+				{Member: "alice", Goods: 998, Total: 998, Products: []string{"蒜头 x2"}},
+			},
+		},
+		{
+			name:        "运费和优惠按商品金额比例分摊",
+			products:    []Product{ordered(ginger, 1), ordered(garlic, 1)},
+			price:       1558,
+			attribution: Attribution{testGingerID: {"alice": 1}},
+			want: []MemberCost{
+				{Member: "alice", Goods: 459, Total: 746, Products: []string{"生姜 x1"}},
+				{Member: unassignedMember, Goods: 499, Total: 812, Products: []string{"蒜头 x1"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &CreateOrderResult{
+				Price: tt.price,
+				Order: Order{Products: tt.products, Substitutions: tt.substitutions},
+			}
+			if got := SplitCost(result, tt.attribution); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitCost() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money 以分为单位的金额，序列化为接口使用的两位小数字符串，如 "4.59"
+type Money int64
+
+// ParseMoney 解析金额字符串，空字符串视为 0
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	yuan, fen := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		yuan, fen = s[:i], s[i+1:]
+	}
+	if yuan == "" {
+		yuan = "0"
+	}
+	// 多余的小数位只允许为 0，避免静默丢失精度
+	if len(fen) > 2 {
+		if strings.Trim(fen[2:], "0") != "" {
+			return 0, fmt.Errorf("金额精度超出分: %s", s)
+		}
+		fen = fen[:2]
+	}
+	for len(fen) < 2 {
+		fen += "0"
+	}
+
+	y, err := strconv.ParseUint(yuan, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("金额格式错误: %s", s)
+	}
+	f, err := strconv.ParseUint(fen, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("金额格式错误: %s", s)
+	}
+	m := Money(y*100 + f)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// Yuan 以元为单位构造金额
+func Yuan(yuan int64) Money {
+	return Money(yuan * 100)
+}
+
+// Mul 金额乘以数量
+func (m Money) Mul(n int) Money {
+	return m * Money(n)
+}
+
+// Float 转换为浮点数，仅用于比例计算
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*m = 0
+		return nil
+	}
+	s := string(data)
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return fmt.Errorf("金额格式错误: %s", s)
+		}
+		s = unquoted
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalText(text []byte) error {
+	v, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OptimizeOption 购物车优化参数
+type OptimizeOption struct {
+	// 预算上限(含运费)
+	Budget Money
+	// 未达到免运费门槛时的运费
+	Freight Money
+	// 免运费门槛，0 表示始终收取运费
+	FreeFreightThreshold Money
+}
+
+// CartPlan 预算内的购物车方案
+type CartPlan struct {
+	Products []Product
+	Dropped  []Product
+	Goods    Money
+	Freight  Money
+	Value    int
+}
+
+// Total 方案总金额(含运费)
+func (p *CartPlan) Total() Money {
+	return p.Goods + p.Freight
+}
+
+func (o OptimizeOption) freight(goods Money) Money {
+	if o.FreeFreightThreshold > 0 && goods >= o.FreeFreightThreshold {
+		return 0
+	}
+	return o.Freight
+}
+
+// optimizeUnit 背包计算的金额单位(角)，避免按分计算时状态表过大
+const optimizeUnit Money = 10
+
+// BaseFreight 未达到免运费门槛时的运费，购物车已免运费时通过检查订单获取原始运费
+func (s *Session) BaseFreight() (Money, error) {
+	if s.Cart.FreightMoney > 0 {
+		return s.Cart.FreightMoney, nil
+	}
+	if s.User != nil && s.User.UserVip.IsVIP() {
+		return 0, nil
+	}
+	// 缺货商品不影响运费
+	var stockoutErr *StockoutError
+	if err := s.CheckOrder(); err != nil && !errors.As(err, &stockoutErr) {
+		return 0, fmt.Errorf("检查订单失败: %v", err)
+	}
+	if s.Order.FreightMoney <= 0 {
+		return 0, errors.New("无法获取站点运费")
+	}
+	return s.Order.FreightMoney, nil
+}
+
+// OptimizeCart 在预算内挑选购物车商品及数量，使商品价值之和最大
+// 按角计算，单价不足一角的部分向上取整，运费按实际商品金额计算。
+// 取整后金额相同的组合只保留价值最高的一个，因此可能错过恰好跨过免运费门槛的方案，结果为近似最优
+func (s *Session) OptimizeCart(opt OptimizeOption) (*CartPlan, error) {
+	if opt.Budget <= 0 {
+		return nil, errors.New("预算必须大于0")
+	}
+
+	type unit struct {
+		index int
+		price int
+		value int
+	}
+	var units []unit
+	for i, p := range s.Cart.ProdList {
+		if p.Price <= 0 {
+			continue
+		}
+		value := s.ProductValue(p)
+		price := int((p.Price + optimizeUnit - 1) / optimizeUnit)
+		for n := 0; n < s.ProductMaxCount(p); n++ {
+			units = append(units, unit{index: i, price: price, value: value})
+		}
+	}
+
+	// 0-1 背包，best[c] 为商品金额(按角取整)恰好为 c 时的最大价值
+	size := int(opt.Budget / optimizeUnit)
+	best := make([]int, size+1)
+	for i := range best {
+		best[i] = -1
+	}
+	best[0] = 0
+	keep := make([][]bool, len(units))
+	for u, item := range units {
+		keep[u] = make([]bool, size+1)
+		for c := size; c >= item.price; c-- {
+			prev := best[c-item.price]
+			if prev != -1 && prev+item.value > best[c] {
+				best[c] = prev + item.value
+				keep[u][c] = true
+			}
+		}
+	}
+
+	// counts 还原金额为 c 时各商品的数量和实际商品金额
+	counts := func(c int) (map[int]int, Money) {
+		result := make(map[int]int)
+		var goods Money
+		for u := len(units) - 1; u >= 0 && c > 0; u-- {
+			if keep[u][c] {
+				index := units[u].index
+				result[index]++
+				goods += s.Cart.ProdList[index].Price
+				c -= units[u].price
+			}
+		}
+		return result, goods
+	}
+
+	var plan *CartPlan
+	var planCounts map[int]int
+	for c := 1; c <= size; c++ {
+		if best[c] == -1 || (plan != nil && best[c] <= plan.Value) {
+			continue
+		}
+		result, goods := counts(c)
+		freight := opt.freight(goods)
+		if goods+freight > opt.Budget {
+			continue
+		}
+		plan = &CartPlan{Value: best[c], Goods: goods, Freight: freight}
+		planCounts = result
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("预算 %s 不足以购买任何商品", opt.Budget)
+	}
+
+	for i, p := range s.Cart.ProdList {
+		if planCounts[i] == 0 {
+			plan.Dropped = append(plan.Dropped, p)
+			continue
+		}
+		p.Count = planCounts[i]
+		p.TotalPrice = p.Price.Mul(p.Count)
+		plan.Products = append(plan.Products, p)
+	}
+	return plan, nil
+}
+
+// ApplyCartPlan 按方案调整购物车，方案外的商品取消勾选
+func (s *Session) ApplyCartPlan(plan *CartPlan) error {
+	counts := make(map[string]int, len(plan.Products))
+	for _, p := range plan.Products {
+		counts[p.Id] = p.Count
+	}
+	for _, p := range s.Cart.ProdList {
+		// 下单商品列表不包含勾选状态，以购物车中的商品为准
+		if item, ok := s.Cart.findItem(p.Id); ok {
+			p = item
+		}
+		count, ok := counts[p.Id]
+		if !ok {
+			if p.IsCheck != 1 {
+				continue
+			}
+			if err := s.CheckCart(p, false); err != nil {
+				return fmt.Errorf("取消勾选商品(%s)失败: %v", p.ProductName, err)
+			}
+			continue
+		}
+		if count != p.Count {
+			if err := s.UpdateCart(p, count); err != nil {
+				return fmt.Errorf("修改商品(%s)数量失败: %v", p.ProductName, err)
+			}
+		}
+		if p.IsCheck != 1 {
+			if err := s.CheckCart(p, true); err != nil {
+				return fmt.Errorf("勾选商品(%s)失败: %v", p.ProductName, err)
+			}
+		}
+	}
+	return s.GetCart()
+}
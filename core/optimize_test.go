@@ -0,0 +1,122 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testGingerID = "5e3f82cf7cdbf0131769408b"
+	testGarlicID = "5e721d22b0055a0b5f763edf"
+)
+
+// testCartSession 使用真实的购物车响应初始化会话
+func testCartSession(t *testing.T) *Session {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "cart.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession("test", 0)
+	s.CartMode = 2
+	if err := s.applyCart(body); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOptimizeCart(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []PriorityRule
+		opt        OptimizeOption
+		want       map[string]int
+		goods      Money
+		freight    Money
+		wantErr    bool
+	}{
+		{
+			name:  "预算充足",
+			opt:   OptimizeOption{Budget: 2000},
+			want:  map[string]int{testGingerID: 1, testGarlicID: 1},
+			goods: 958,
+		},
+		{
+			name:       "预算只够一件时选择价值高的商品",
+			priorities: []PriorityRule{{ID: testGarlicID, Tier: 1, Value: 3}},
+			opt:        OptimizeOption{Budget: 500},
+			want:       map[string]int{testGarlicID: 1},
+			goods:      499,
+		},
+		{
+			name:    "运费计入预算",
+			opt:     OptimizeOption{Budget: 1500, Freight: 800},
+			want:    map[string]int{testGingerID: 1},
+			goods:   459,
+			freight: 800,
+		},
+		{
+			name:  "达到免运费门槛",
+			opt:   OptimizeOption{Budget: 1500, Freight: 800, FreeFreightThreshold: 900},
+			want:  map[string]int{testGingerID: 1, testGarlicID: 1},
+			goods: 958,
+		},
+		{
+			name:       "购买数量受购物车库存限制",
+			priorities: []PriorityRule{{ID: testGingerID, Tier: 1, MaxCount: 3}},
+			opt:        OptimizeOption{Budget: 5000},
+			want:       map[string]int{testGingerID: 1, testGarlicID: 1},
+			goods:      958,
+		},
+		{
+			name:    "预算不足",
+			opt:     OptimizeOption{Budget: 400},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testCartSession(t)
+			if err := s.SetPriorities(tt.priorities); err != nil {
+				t.Fatal(err)
+			}
+			plan, err := s.OptimizeCart(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OptimizeCart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make(map[string]int)
+			for _, p := range plan.Products {
+				got[p.Id] = p.Count
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("OptimizeCart() products = %v, want %v", got, tt.want)
+			}
+			for id, count := range tt.want {
+				if got[id] != count {
+					t.Errorf("OptimizeCart() count of %s = %d, want %d", id, got[id], count)
+				}
+			}
+			if plan.Goods != tt.goods || plan.Freight != tt.freight {
+				t.Errorf("OptimizeCart() goods = %s, freight = %s, want %s, %s", plan.Goods, plan.Freight, tt.goods, tt.freight)
+			}
+		})
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/sirupsen/logrus"
 	"net/http"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,17 +29,34 @@ import (
 )
 
 type Order struct {
-	Products []Product `json:"products"`
-	Price    string    `json:"price"`
+	Products      []Product      `json:"products"`
+	Price         Money          `json:"price"`
+	Substitutions []Substitution `json:"substitutions"`
+
+	FreightMoney         Money `json:"freight_money"`
+	FreightDiscountMoney Money `json:"freight_discount_money"`
+	FreightRealMoney     Money `json:"freight_real_money"`
+
+	UserTicket    *Coupon `json:"user_ticket"`
+	FreightTicket *Coupon `json:"freight_ticket"`
+	CouponMoney   Money   `json:"coupon_money"`
+	// 商品立减和活动优惠金额，来自检查订单
+	RebateMoney Money `json:"rebate_money"`
+
+	UseBalance     bool  `json:"use_balance"`
+	UsedPointNum   int   `json:"used_point_num"`
+	UsedPointMoney Money `json:"used_point_money"`
 }
 
 type Package struct {
-	Products             []map[string]interface{} `json:"products"`
-	PackageId            int                      `json:"package_id"`
-	PackageType          int                      `json:"package_type"`
-	FirstSelectedBigTime string                   `json:"first_selected_big_time"`
-	EtaTraceId           string                   `json:"eta_trace_id"`
-	SoonArrival          int                      `json:"soon_arrival"`
+	// 提交订单成功后服务端返回的订单号
+	Id                   string           `json:"id,omitempty"`
+	Products             []PackageProduct `json:"products"`
+	PackageId            int              `json:"package_id"`
+	PackageType          int              `json:"package_type"`
+	FirstSelectedBigTime string           `json:"first_selected_big_time"`
+	EtaTraceId           string           `json:"eta_trace_id"`
+	SoonArrival          int              `json:"soon_arrival"`
 
 	ReservedTimeStart int `json:"reserved_time_start"`
 	ReservedTimeEnd   int `json:"reserved_time_end"`
@@ -49,9 +65,9 @@ type Package struct {
 type PaymentOrder struct {
 	ReservedTimeStart    int    `json:"reserved_time_start"`
 	ReservedTimeEnd      int    `json:"reserved_time_end"`
-	FreightDiscountMoney string `json:"freight_discount_money"`
-	FreightMoney         string `json:"freight_money"`
-	OrderFreight         string `json:"order_freight"`
+	FreightDiscountMoney Money  `json:"freight_discount_money"`
+	FreightMoney         Money  `json:"freight_money"`
+	OrderFreight         Money  `json:"order_freight"`
 	AddressId            string `json:"address_id"`
 	UsedPointNum         int    `json:"used_point_num"`
 	ParentOrderSign      string `json:"parent_order_sign"`
@@ -59,7 +75,9 @@ type PaymentOrder struct {
 	OrderType            int    `json:"order_type"`
 	IsUseBalance         int    `json:"is_use_balance"`
 	ReceiptWithoutSku    string `json:"receipt_without_sku"`
-	Price                string `json:"price"`
+	Price                Money  `json:"price"`
+	UserTicketId         string `json:"user_ticket_id,omitempty"`
+	FreightTicketId      string `json:"freight_ticket_id,omitempty"`
 }
 
 type PackageOrder struct {
@@ -74,69 +92,85 @@ type AddNewOrderReturnData struct {
 	Data    struct {
 		PackageOrder     PackageOrder `json:"package_order"`
 		StockoutProducts []Product    `json:"stockout_products"`
+		PayExpireTime    int64        `json:"pay_expire_time"`
 	} `json:"data"`
 }
 
-func (s *Session) GeneratePackageOrder() {
-	var products []map[string]interface{}
-	for _, product := range s.Order.Products {
-		prod := map[string]interface{}{
-			"id":                   product.Id,
-			"total_money":          product.TotalPrice,
-			"total_origin_money":   product.OriginPrice,
-			"count":                product.Count,
-			"price":                product.Price,
-			"instant_rebate_money": "0.00",
-			"origin_price":         product.OriginPrice,
-			"sizes":                product.Sizes,
-		}
-		products = append(products, prod)
-	}
+// CreateOrderResult 提交订单的结果
+type CreateOrderResult struct {
+	OrderIds         []string
+	Price            Money
+	ReserveTime      ReserveTime
+	StockoutProducts []Product
+	// 支付截止时间，服务端未返回时为零值
+	PayExpireTime time.Time
+	// 提交的订单快照
+	Order Order
+	// 购物车中未下单或未全部下单的商品
+	Unavailable []UnavailableProduct
+}
 
-	p := Package{
-		FirstSelectedBigTime: "0",
-		Products:             products,
-		EtaTraceId:           "",
-		PackageId:            1,
-		PackageType:          1,
+func (s *Session) newCreateOrderResult(data *AddNewOrderReturnData) *CreateOrderResult {
+	paymentOrder := data.Data.PackageOrder.PaymentOrder
+	if paymentOrder.Price == 0 {
+		paymentOrder = s.PackageOrder.PaymentOrder
 	}
-	paymentOrder := PaymentOrder{
-		FreightDiscountMoney: "5.00",
-		FreightMoney:         "5.00",
-		OrderFreight:         "0.00",
-		AddressId:            s.Address.Id,
-		UsedPointNum:         0,
-		ParentOrderSign:      s.Cart.ParentOrderSign,
-		PayType:              s.PayType,
-		OrderType:            1,
-		IsUseBalance:         0,
-		ReceiptWithoutSku:    "1",
-		Price:                s.Order.Price,
+	result := &CreateOrderResult{
+		Price: paymentOrder.Price,
+		ReserveTime: ReserveTime{
+			StartTimestamp: paymentOrder.ReservedTimeStart,
+			EndTimestamp:   paymentOrder.ReservedTimeEnd,
+		},
+		StockoutProducts: data.Data.StockoutProducts,
+		Order:            *s.Order,
+		Unavailable:      s.UnavailableProducts(),
 	}
-	price, _ := strconv.ParseFloat(paymentOrder.Price, 32)
-	if price < 39 {
-		paymentOrder.OrderFreight = "5.00"
+	result.Order.Products = append([]Product(nil), s.Order.Products...)
+	if result.ReserveTime.StartTimestamp == 0 {
+		result.ReserveTime.StartTimestamp = s.PackageOrder.PaymentOrder.ReservedTimeStart
+		result.ReserveTime.EndTimestamp = s.PackageOrder.PaymentOrder.ReservedTimeEnd
 	}
-	packageOrder := PackageOrder{
-		Packages: []*Package{
-			&p,
-		},
-		PaymentOrder: paymentOrder,
+	for _, p := range data.Data.PackageOrder.Packages {
+		if p.Id != "" {
+			result.OrderIds = append(result.OrderIds, p.Id)
+		}
 	}
-	start := s.PackageOrder.PaymentOrder.ReservedTimeStart
-	end := s.PackageOrder.PaymentOrder.ReservedTimeEnd
-	s.PackageOrder = &packageOrder
-	s.PackageOrder.PaymentOrder.ReservedTimeStart = start
-	s.PackageOrder.PaymentOrder.ReservedTimeEnd = end
+	if data.Data.PayExpireTime > 0 {
+		result.PayExpireTime = time.Unix(data.Data.PayExpireTime, 0)
+	}
+	return result
 }
 
-func (s *Session) UpdatePackageOrder(reserveTime ReserveTime) {
-	s.PackageOrder.PaymentOrder.ReservedTimeStart = reserveTime.StartTimestamp
-	s.PackageOrder.PaymentOrder.ReservedTimeEnd = reserveTime.EndTimestamp
+func (s *Session) GeneratePackageOrder() {
+	opt := PayloadOption{
+		AddressId:       s.Address.Id,
+		ParentOrderSign: s.Cart.ParentOrderSign,
+		PayType:         s.PayType,
+		ReserveTimes:    s.PackageOrder.reserveTimes(),
+	}
+	packageOrder, err := BuildPackageOrder(s.Order, opt)
+	if err != nil {
+		// 包裹数量变化后之前的预约时间不再适用，提交前按新的包裹重新设置
+		opt.ReserveTimes = nil
+		packageOrder, _ = BuildPackageOrder(s.Order, opt)
+	}
+	s.PackageOrder = packageOrder
+}
+
+// UpdatePackageOrder 设置各包裹的预约时间，按包裹ID顺序传入
+// 会复制提交订单的内容，避免并发提交时互相影响
+func (s *Session) UpdatePackageOrder(reserveTimes ...ReserveTime) error {
+	packageOrder := *s.PackageOrder
+	packageOrder.Packages = make([]*Package, 0, len(s.PackageOrder.Packages))
 	for _, p := range s.PackageOrder.Packages {
-		p.ReservedTimeStart = reserveTime.StartTimestamp
-		p.ReservedTimeEnd = reserveTime.EndTimestamp
+		pkg := *p
+		packageOrder.Packages = append(packageOrder.Packages, &pkg)
 	}
+	if err := packageOrder.setReserveTimes(reserveTimes); err != nil {
+		return err
+	}
+	s.PackageOrder = &packageOrder
+	return nil
 }
 
 func (s *Session) OrderFlashSale() error {
@@ -147,10 +181,14 @@ func (s *Session) OrderFlashSale() error {
 	req := s.client.R()
 	req.Header = s.buildHeader()
 	req.SetBody(strings.NewReader(params.Encode()))
-	_, err := s.execute(context.TODO(), req, http.MethodGet, urlPath)
+	resp, err := s.execute(context.TODO(), req, http.MethodGet, urlPath)
 	if err != nil {
 		return err
 	}
+	// 运力约满时接口依旧返回成功状态码，只能通过提示信息判断，提示的前半部分可能变化，按“运力已约满”匹配
+	if msg := gjson.GetBytes(resp.Body(), "msg").Str; strings.Contains(msg, "运力已约满") {
+		return ErrCapacityFull
+	}
 	return nil
 }
 
@@ -160,13 +198,44 @@ var (
 )
 
 func (s *Session) CheckOrder() error {
+	// 积分超出上限或余额是否足够的判断变化时按新的选择重新检查，最多检查 3 次
+	for i := 0; ; i++ {
+		// 检查订单和提交订单使用同一个余额选择
+		s.Order.UseBalance = s.useBalance()
+		result, err := s.requestCheckOrder()
+		if err != nil {
+			return err
+		}
+		mutex := sync.Mutex{}
+		mutex.Lock()
+		s.applyCheckOrder(result)
+		mutex.Unlock()
+		if i < 2 && (s.limitPoints() || s.Order.UseBalance != s.useBalance()) {
+			continue
+		}
+		s.GeneratePackageOrder()
+		if stockouts := result.Data.StockoutProducts; len(stockouts) > 0 {
+			return &StockoutError{Products: stockouts}
+		}
+		return nil
+	}
+}
+
+// requestCheckOrder 请求检查订单接口
+func (s *Session) requestCheckOrder() (*CheckOrderResult, error) {
 	urlPath := "https://maicai.api.ddxq.mobi/order/checkOrder"
-	req := s.buildCheckOrderReq()
+	req, err := s.buildCheckOrderReq()
+	if err != nil {
+		return nil, err
+	}
 	checkOrderReqOnce.Do(func() {
 		logrus.Info("-----------检查订单-刷新请求守护线程启动-------------")
 		go func() {
 			for {
-				req = s.buildCheckOrderReq()
+				// 生成失败时保留上一次的请求
+				if r, err := s.buildCheckOrderReq(); err == nil {
+					req = r
+				}
 				time.Sleep(time.Millisecond)
 			}
 		}()
@@ -174,61 +243,47 @@ func (s *Session) CheckOrder() error {
 	startTime := time.Now()
 	resp, err := s.execute(context.TODO(), req, http.MethodPost, urlPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logrus.Info(fmt.Sprintf("检查订单耗时%+v\n", time.Now().Sub(startTime)))
-	mutex := sync.Mutex{}
-	mutex.Lock()
-	defer mutex.Unlock()
-	s.Order.Price = gjson.Get(resp.String(), "data.order.total_money").Str
-	s.GeneratePackageOrder()
-	return nil
+	var result CheckOrderResult
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return nil, fmt.Errorf("parse response failed: %v, body: %v", err, resp.String())
+	}
+	for _, msg := range result.Messages() {
+		logrus.Warningf("检查订单提示: %s", msg)
+	}
+	return &result, nil
 }
-func (s *Session) buildCheckOrderReq() *resty.Request {
-	var products []map[string]interface{}
-	for _, product := range s.Order.Products {
-		prod := map[string]interface{}{
-			"id":                   product.Id,
-			"total_money":          product.TotalPrice,
-			"total_origin_money":   product.OriginPrice,
-			"count":                product.Count,
-			"price":                product.Price,
-			"instant_rebate_money": "0.00",
-			"origin_price":         product.OriginPrice,
-			"sizes":                product.Sizes,
-		}
-		products = append(products, prod)
+
+// CheckPriceLimit 检查订单金额是否超出上限
+func (s *Session) CheckPriceLimit() error {
+	if s.MaxPrice <= 0 {
+		return nil
 	}
-	packagesInfo := []map[string]interface{}{
-		{
-			"package_type": 1,
-			"package_id":   1,
-			"products":     products,
-		},
+	if s.Order.Price > s.MaxPrice {
+		return fmt.Errorf("%w: %s > %s", ErrOverPriceLimit, s.Order.Price, s.MaxPrice)
 	}
-	packagesJson, _ := json.Marshal(packagesInfo)
+	return nil
+}
 
+func (s *Session) buildCheckOrderReq() (*resty.Request, error) {
 	params := s.buildURLParams(true)
-	params.Add("user_ticket_id", "default")
-	params.Add("freight_ticket_id", "default")
-	params.Add("is_use_point", "0")
-	params.Add("is_use_balance", "0")
-	params.Add("is_buy_vip", "0")
-	params.Add("coupons_id", "")
-	params.Add("is_buy_coupons", "0")
-	params.Add("packages", string(packagesJson))
-	params.Add("check_order_type", "0")
-	params.Add("is_support_merge_payment", "0")
-	params.Add("showData", "true")
-	params.Add("showMsg", "false")
+	orderParams, err := BuildCheckOrderParams(s.Order, s.usePoint(), s.Order.UseBalance)
+	if err != nil {
+		return nil, fmt.Errorf("生成检查订单请求失败: %v", err)
+	}
+	for k, v := range orderParams {
+		params[k] = v
+	}
 
 	req := s.client.R()
 	req.Header = s.buildHeader()
 	req.SetBody(strings.NewReader(params.Encode()))
-	return req
+	return req, nil
 }
 
-func (s *Session) CreateOrder(ctx context.Context) error {
+func (s *Session) CreateOrder(ctx context.Context) (*CreateOrderResult, error) {
 	urlPath := "https://maicai.api.ddxq.mobi/order/addNewOrder"
 	req := s.buildCreateOrderReq()
 	createOrderReqOnce.Do(func() {
@@ -241,8 +296,50 @@ func (s *Session) CreateOrder(ctx context.Context) error {
 		}()
 	})
 	WaitStart()
-	_, err := s.execute(ctx, req, http.MethodPost, urlPath)
-	return err
+	if err := s.ValidateOrder(); err != nil {
+		return nil, err
+	}
+	resp, err := s.execute(ctx, req, http.MethodPost, urlPath)
+	if resp == nil {
+		return nil, err
+	}
+
+	var data AddNewOrderReturnData
+	if e := json.Unmarshal(resp.Body(), &data); e != nil {
+		if err != nil {
+			return nil, err
+		}
+		// 服务端已确认下单成功，解析失败不能视为下单失败，否则会重复提交
+		logrus.Warningf("解析提交订单结果失败: %v, body: %v", e, resp.String())
+		data = parseAddNewOrder(resp.Body())
+	}
+	result := s.newCreateOrderResult(&data)
+	if err != nil {
+		// 仅在服务端拒绝提交时按缺货处理，调整商品后重新提交
+		if len(result.StockoutProducts) > 0 {
+			return result, &StockoutError{Products: result.StockoutProducts}
+		}
+		return result, err
+	}
+	// 已下单成功，缺货商品不会重新提交，避免重复下单
+	for _, p := range result.StockoutProducts {
+		logrus.Warningf("下单成功，以下商品缺货未下单: %s", p.ProductName)
+	}
+	return result, nil
+}
+
+// parseAddNewOrder 完整解析失败时读取提交订单结果中的订单号和支付截止时间
+func parseAddNewOrder(body []byte) AddNewOrderReturnData {
+	result := gjson.ParseBytes(body)
+	var data AddNewOrderReturnData
+	data.Success = result.Get("success").Bool()
+	data.Code = int(result.Get("code").Int())
+	data.Msg = result.Get("msg").Str
+	for _, id := range result.Get("data.package_order.packages.#.id").Array() {
+		data.Data.PackageOrder.Packages = append(data.Data.PackageOrder.Packages, &Package{Id: id.String()})
+	}
+	data.Data.PayExpireTime = result.Get("data.pay_expire_time").Int()
+	return data
 }
 
 func (s *Session) buildCreateOrderReq() *resty.Request {
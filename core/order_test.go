@@ -0,0 +1,59 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stubTransport 所有请求均返回指定的响应内容
+type stubTransport string
+
+func (t stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(string(t))),
+		Request:    req,
+	}, nil
+}
+
+func TestOrderFlashSale(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want error
+	}{
+		{name: "运力充足", msg: "success"},
+		{name: "运力已约满", msg: ErrCapacityFull.Error(), want: ErrCapacityFull},
+		{name: "提示前缀变化", msg: "配送运力紧张，本站点当前运力已约满 ", want: ErrCapacityFull},
+		{name: "其他运力提示", msg: "当前运力紧张，请尽快下单"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{"success": true, "code": 0, "msg": tt.msg})
+			s := NewSession("test", 0)
+			s.Address = &AddressItem{}
+			s.client.SetTransport(stubTransport(body))
+			if err := s.OrderFlashSale(); err != tt.want {
+				t.Errorf("OrderFlashSale() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
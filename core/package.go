@@ -0,0 +1,100 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	defaultPackageType = 1
+	defaultPackageId   = 1
+)
+
+// ProductPackage 按配送方式划分的商品包裹，预售、预订和大宗商品需要单独配送
+type ProductPackage struct {
+	PackageType int
+	PackageId   int
+	Products    []Product
+}
+
+// markPackages 使用购物车返回的包裹信息标记商品所属的包裹
+func markPackages(products []Product, groups []OrderProductInfo) {
+	type packageInfo struct{ packageType, packageId int }
+	known := make(map[string]packageInfo)
+	for _, g := range groups {
+		for _, p := range g.Products {
+			known[p.Id] = packageInfo{packageType: g.PackageType, packageId: g.PackageId}
+		}
+	}
+	for i := range products {
+		if info, ok := known[products[i].Id]; ok {
+			products[i].PackageType = info.packageType
+			products[i].PackageId = info.packageId
+		}
+	}
+}
+
+// packageKey 未获取到包裹信息时，根据预售、预订和大宗属性划分包裹，普通商品返回空
+func packageKey(p Product) string {
+	if p.IsPresale == 0 && p.IsBooking == 0 && p.IsBulk == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s/%d/%d/%d/%d",
+		p.PresaleType, p.PresaleId, p.DeliveryStartTime, p.DeliveryEndTime, p.IsBooking, p.IsBulk)
+}
+
+// GroupPackages 将商品划分为包裹，按包裹ID排序
+func GroupPackages(products []Product) []ProductPackage {
+	maxId := defaultPackageId
+	for _, p := range products {
+		if p.PackageId > maxId {
+			maxId = p.PackageId
+		}
+	}
+
+	var packages []ProductPackage
+	index := make(map[int]int)
+	derived := map[string]int{"": defaultPackageId}
+	for _, p := range products {
+		packageType, packageId := p.PackageType, p.PackageId
+		if packageId == 0 {
+			key := packageKey(p)
+			id, ok := derived[key]
+			if !ok {
+				maxId++
+				id = maxId
+				derived[key] = id
+			}
+			packageType, packageId = defaultPackageType, id
+		}
+		if packageType == 0 {
+			packageType = defaultPackageType
+		}
+
+		i, ok := index[packageId]
+		if !ok {
+			i = len(packages)
+			index[packageId] = i
+			packages = append(packages, ProductPackage{PackageType: packageType, PackageId: packageId})
+		}
+		packages[i].Products = append(packages[i].Products, p)
+	}
+	sort.SliceStable(packages, func(i, j int) bool {
+		return packages[i].PackageId < packages[j].PackageId
+	})
+	return packages
+}
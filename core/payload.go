@@ -0,0 +1,181 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// PackageProduct 检查订单和提交订单请求中的商品
+type PackageProduct struct {
+	Id                 string                   `json:"id"`
+	TotalMoney         Money                    `json:"total_money"`
+	TotalOriginMoney   Money                    `json:"total_origin_money"`
+	Count              int                      `json:"count"`
+	Price              Money                    `json:"price"`
+	InstantRebateMoney Money                    `json:"instant_rebate_money"`
+	OriginPrice        Money                    `json:"origin_price"`
+	Sizes              []map[string]interface{} `json:"sizes"`
+}
+
+// CheckOrderPackage 检查订单请求中的包裹
+type CheckOrderPackage struct {
+	PackageType int              `json:"package_type"`
+	PackageId   int              `json:"package_id"`
+	Products    []PackageProduct `json:"products"`
+}
+
+// PayloadOption 生成订单请求所需的会话状态
+type PayloadOption struct {
+	AddressId       string
+	ParentOrderSign string
+	PayType         int
+	// 各包裹的预约时间，按包裹ID排序
+	ReserveTimes []ReserveTime
+}
+
+func newPackageProducts(products []Product) []PackageProduct {
+	result := make([]PackageProduct, 0, len(products))
+	for _, p := range products {
+		result = append(result, PackageProduct{
+			Id:                 p.Id,
+			TotalMoney:         p.TotalPrice,
+			TotalOriginMoney:   p.OriginPrice,
+			Count:              p.Count,
+			Price:              p.Price,
+			InstantRebateMoney: p.InstantRebateMoney,
+			OriginPrice:        p.OriginPrice,
+			Sizes:              p.Sizes,
+		})
+	}
+	return result
+}
+
+// buildPackages 将下单商品按配送方式组装为包裹
+func buildPackages(products []Product) []*Package {
+	groups := GroupPackages(products)
+	packages := make([]*Package, 0, len(groups))
+	for _, g := range groups {
+		packages = append(packages, &Package{
+			FirstSelectedBigTime: "0",
+			Products:             newPackageProducts(g.Products),
+			EtaTraceId:           "",
+			PackageId:            g.PackageId,
+			PackageType:          g.PackageType,
+		})
+	}
+	return packages
+}
+
+// setReserveTimes 设置各包裹的预约时间，时间段数量必须与包裹数量一致
+func (o *PackageOrder) setReserveTimes(reserveTimes []ReserveTime) error {
+	if len(reserveTimes) == 0 {
+		return nil
+	}
+	if len(o.Packages) > 0 && len(reserveTimes) != len(o.Packages) {
+		return fmt.Errorf("预约时间段数量(%d)与包裹数量(%d)不一致", len(reserveTimes), len(o.Packages))
+	}
+	o.PaymentOrder.ReservedTimeStart = reserveTimes[0].StartTimestamp
+	o.PaymentOrder.ReservedTimeEnd = reserveTimes[0].EndTimestamp
+	for i, p := range o.Packages {
+		p.ReservedTimeStart = reserveTimes[i].StartTimestamp
+		p.ReservedTimeEnd = reserveTimes[i].EndTimestamp
+	}
+	return nil
+}
+
+// reserveTimes 各包裹当前的预约时间
+func (o *PackageOrder) reserveTimes() []ReserveTime {
+	result := make([]ReserveTime, 0, len(o.Packages))
+	for _, p := range o.Packages {
+		result = append(result, ReserveTime{StartTimestamp: p.ReservedTimeStart, EndTimestamp: p.ReservedTimeEnd})
+	}
+	if len(result) == 0 {
+		result = append(result, ReserveTime{
+			StartTimestamp: o.PaymentOrder.ReservedTimeStart,
+			EndTimestamp:   o.PaymentOrder.ReservedTimeEnd,
+		})
+	}
+	return result
+}
+
+// BuildPackageOrder 根据订单生成提交订单的请求内容
+func BuildPackageOrder(order *Order, opt PayloadOption) (*PackageOrder, error) {
+	paymentOrder := PaymentOrder{
+		FreightDiscountMoney: order.FreightDiscountMoney,
+		FreightMoney:         order.FreightMoney,
+		OrderFreight:         order.FreightRealMoney,
+		AddressId:            opt.AddressId,
+		UsedPointNum:         order.UsedPointNum,
+		ParentOrderSign:      opt.ParentOrderSign,
+		PayType:              opt.PayType,
+		OrderType:            1,
+		IsUseBalance:         0,
+		ReceiptWithoutSku:    "1",
+		Price:                order.Price,
+	}
+	if order.UseBalance {
+		paymentOrder.IsUseBalance = 1
+	}
+	if order.UserTicket != nil {
+		paymentOrder.UserTicketId = order.UserTicket.Id
+	}
+	if order.FreightTicket != nil {
+		paymentOrder.FreightTicketId = order.FreightTicket.Id
+	}
+
+	packageOrder := &PackageOrder{
+		Packages:     buildPackages(order.Products),
+		PaymentOrder: paymentOrder,
+	}
+	if err := packageOrder.setReserveTimes(opt.ReserveTimes); err != nil {
+		return nil, err
+	}
+	return packageOrder, nil
+}
+
+// BuildCheckOrderParams 生成检查订单请求中与订单相关的参数
+func BuildCheckOrderParams(order *Order, usePoint, useBalance bool) (url.Values, error) {
+	packages := buildPackages(order.Products)
+	checkPackages := make([]CheckOrderPackage, 0, len(packages))
+	for _, p := range packages {
+		checkPackages = append(checkPackages, CheckOrderPackage{
+			PackageType: p.PackageType,
+			PackageId:   p.PackageId,
+			Products:    p.Products,
+		})
+	}
+	packagesJson, err := json.Marshal(checkPackages)
+	if err != nil {
+		return nil, fmt.Errorf("marshal packages failed: %v", err)
+	}
+
+	params := url.Values{}
+	params.Add("user_ticket_id", ticketID(order.UserTicket))
+	params.Add("freight_ticket_id", ticketID(order.FreightTicket))
+	params.Add("is_use_point", boolFlag(usePoint))
+	params.Add("is_use_balance", boolFlag(useBalance))
+	params.Add("is_buy_vip", "0")
+	params.Add("coupons_id", couponsID(order.UserTicket, order.FreightTicket))
+	params.Add("is_buy_coupons", "0")
+	params.Add("packages", string(packagesJson))
+	params.Add("check_order_type", "0")
+	params.Add("is_support_merge_payment", "0")
+	params.Add("showData", "true")
+	params.Add("showMsg", "false")
+	return params, nil
+}
@@ -0,0 +1,160 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+func testOrder() *Order {
+	return &Order{
+		Products: []Product{
+			{
+				Id:          "5e3f82cf7cdbf0131769408b",
+				ProductName: "生姜 约300g",
+				Price:       459,
+				OriginPrice: 459,
+				TotalPrice:  918,
+				Count:       2,
+				Sizes:       []map[string]interface{}{},
+				PackageType: 1,
+				PackageId:   1,
+			},
+			{
+				Id:                 "5e721d22b0055a0b5f763edf",
+				ProductName:        "鸡蛋 30枚",
+				Price:              2590,
+				OriginPrice:        2990,
+				TotalPrice:         2590,
+				InstantRebateMoney: 400,
+				Count:              1,
+				Sizes:              []map[string]interface{}{{"name": "30枚"}},
+			},
+			{
+				Id:                "6253d2a7b1d1d3d2a8f3e001",
+				ProductName:       "预售大米 5kg",
+				Price:             4990,
+				OriginPrice:       4990,
+				TotalPrice:        4990,
+				Count:             1,
+				IsPresale:         1,
+				PresaleId:         "presale-1",
+				PresaleType:       1,
+				DeliveryStartTime: 1650000000,
+				DeliveryEndTime:   1650086400,
+			},
+		},
+		Price:                8298,
+		FreightMoney:         800,
+		FreightDiscountMoney: 800,
+		UserTicket:           &Coupon{Id: "user-ticket", Type: CouponTypeGoods},
+		FreightTicket:        &Coupon{Id: "freight-ticket", Type: CouponTypeFreight},
+		UseBalance:           true,
+		UsedPointNum:         100,
+	}
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s 与 golden 文件不一致，使用 -update 更新\n got: %s\nwant: %s", name, got, want)
+	}
+}
+
+func TestBuildPackageOrder(t *testing.T) {
+	order, err := BuildPackageOrder(testOrder(), PayloadOption{
+		AddressId:       "address-1",
+		ParentOrderSign: "parent-sign",
+		PayType:         4,
+		ReserveTimes: []ReserveTime{
+			{StartTimestamp: 1649984400, EndTimestamp: 1649988000},
+			{StartTimestamp: 1650002400, EndTimestamp: 1650006000},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(order, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "package_order.golden", append(got, '\n'))
+}
+
+func TestBuildPackageOrderReserveTimes(t *testing.T) {
+	tests := []struct {
+		name    string
+		times   []ReserveTime
+		wantErr bool
+	}{
+		{name: "未指定预约时间"},
+		{
+			name: "每个包裹一个时间段",
+			times: []ReserveTime{
+				{StartTimestamp: 1649984400, EndTimestamp: 1649988000},
+				{StartTimestamp: 1650002400, EndTimestamp: 1650006000},
+			},
+		},
+		{
+			name:    "时间段少于包裹",
+			times:   []ReserveTime{{StartTimestamp: 1649984400, EndTimestamp: 1649988000}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BuildPackageOrder(testOrder(), PayloadOption{ReserveTimes: tt.times})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BuildPackageOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildCheckOrderParams(t *testing.T) {
+	params, err := BuildCheckOrderParams(testOrder(), true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s=%s\n", k, params.Get(k))
+	}
+	checkGolden(t, "check_order_params.golden", buf.Bytes())
+}
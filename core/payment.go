@@ -0,0 +1,111 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PaymentPolicy 积分和余额抵扣策略
+type PaymentPolicy struct {
+	// 余额足够支付订单时使用余额
+	UseBalance bool `yaml:"use_balance"`
+	// 最多使用的积分数，0 表示不使用积分
+	// 接口只能选择是否使用积分，无法指定积分数量，服务端使用的积分超出上限时本次下单流程不再使用积分
+	MaxPoints int `yaml:"max_points"`
+}
+
+// CheckPaymentPolicy 根据账户实际的余额和积分检查抵扣策略
+func (s *Session) CheckPaymentPolicy() {
+	if s.User == nil {
+		return
+	}
+	if s.PaymentPolicy.MaxPoints > s.User.PointNum {
+		logrus.Warningf("账户积分(%d)少于配置的积分上限(%d)，最多使用 %d 积分",
+			s.User.PointNum, s.PaymentPolicy.MaxPoints, s.User.PointNum)
+	}
+	if !s.PaymentPolicy.UseBalance {
+		return
+	}
+	if !s.User.Balance.BalanceKnown {
+		logrus.Warning("账户余额未知，不会使用余额支付")
+	} else if s.User.Balance.Balance <= 0 {
+		logrus.Warning("账户余额为 0，不会使用余额支付")
+	}
+}
+
+// pointLimit 本次订单最多可使用的积分
+func (s *Session) pointLimit() int {
+	if s.User == nil || s.PaymentPolicy.MaxPoints <= 0 {
+		return 0
+	}
+	if s.User.PointNum < s.PaymentPolicy.MaxPoints {
+		return s.User.PointNum
+	}
+	return s.PaymentPolicy.MaxPoints
+}
+
+// usePoint 是否使用积分，服务端使用的积分超出上限后不再使用
+func (s *Session) usePoint() bool {
+	return s.pointLimit() > 0 && !s.pointsOff
+}
+
+// ResetPoints 重新尝试使用积分，每次下单流程开始时调用
+func (s *Session) ResetPoints() {
+	s.pointsOff = false
+}
+
+// limitPoints 服务端使用的积分超出上限时关闭积分抵扣，返回是否需要重新检查订单
+func (s *Session) limitPoints() bool {
+	if !s.usePoint() || s.Order.UsedPointNum <= s.pointLimit() {
+		return false
+	}
+	logrus.Warningf("服务端使用积分 %d 超出上限 %d，不再使用积分", s.Order.UsedPointNum, s.pointLimit())
+	s.pointsOff = true
+	return true
+}
+
+// useBalance 余额足够支付订单金额时使用余额，未检查订单时按购物车金额判断
+func (s *Session) useBalance() bool {
+	if s.User == nil || !s.PaymentPolicy.UseBalance || !s.User.Balance.BalanceKnown {
+		return false
+	}
+	price := s.Order.Price
+	if price == 0 {
+		price = s.Cart.TotalMoney
+	}
+	return s.User.Balance.Balance >= price
+}
+
+// validatePayment 校验服务端实际使用的积分和余额是否符合策略，仅在请求使用积分时校验积分上限
+func (s *Session) validatePayment() []string {
+	var violations []string
+	if limit := s.pointLimit(); s.usePoint() && s.Order.UsedPointNum > limit {
+		violations = append(violations, fmt.Sprintf("使用积分 %d 超出上限 %d", s.Order.UsedPointNum, limit))
+	}
+	if s.Order.UseBalance && (s.User == nil || s.User.Balance.Balance < s.PackageOrder.PaymentOrder.Price) {
+		violations = append(violations, fmt.Sprintf("账户余额不足以支付订单金额 %s", s.PackageOrder.PaymentOrder.Price))
+	}
+	return violations
+}
+
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
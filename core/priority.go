@@ -0,0 +1,174 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// PriorityRule 商品优先级规则，按商品ID或名称正则匹配
+// Tier 越小越重要，1 表示必需品，未匹配任何规则的商品优先级最低
+type PriorityRule struct {
+	ID      string `yaml:"id"`
+	Pattern string `yaml:"pattern"`
+	Tier    int    `yaml:"tier"`
+	// 单件商品的价值，用于预算内优化购物车，默认根据 Tier 计算
+	Value int `yaml:"value"`
+	// 购买数量上限，默认为购物车中的数量
+	MaxCount int `yaml:"max_count"`
+
+	re *regexp.Regexp
+}
+
+func (r *PriorityRule) match(p Product) bool {
+	if r.ID != "" && r.ID == p.Id {
+		return true
+	}
+	return r.re != nil && r.re.MatchString(p.ProductName)
+}
+
+// SetPriorities 设置商品优先级规则
+func (s *Session) SetPriorities(rules []PriorityRule) error {
+	result := make([]PriorityRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Tier < 1 {
+			return fmt.Errorf("商品优先级必须大于0: %+v", rule)
+		}
+		if rule.ID == "" && rule.Pattern == "" {
+			return fmt.Errorf("商品优先级规则缺少id或pattern: %+v", rule)
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("商品优先级规则(%s)格式错误: %v", rule.Pattern, err)
+			}
+			rule.re = re
+		}
+		result = append(result, rule)
+	}
+	s.priorities = result
+	return nil
+}
+
+func (s *Session) matchPriority(p Product) *PriorityRule {
+	for i := range s.priorities {
+		if s.priorities[i].match(p) {
+			return &s.priorities[i]
+		}
+	}
+	return nil
+}
+
+func (s *Session) lowestTier() int {
+	lowest := 0
+	for _, rule := range s.priorities {
+		if rule.Tier > lowest {
+			lowest = rule.Tier
+		}
+	}
+	return lowest
+}
+
+// ProductTier 获取商品的优先级，未配置规则时均为 0
+func (s *Session) ProductTier(p Product) int {
+	if rule := s.matchPriority(p); rule != nil {
+		return rule.Tier
+	}
+	if lowest := s.lowestTier(); lowest > 0 {
+		return lowest + 1
+	}
+	return 0
+}
+
+// ProductValue 商品单件的价值，优先级越高价值越大，未配置规则时均为 1
+func (s *Session) ProductValue(p Product) int {
+	rule := s.matchPriority(p)
+	if rule != nil && rule.Value > 0 {
+		return rule.Value
+	}
+	tier := s.ProductTier(p)
+	if tier == 0 {
+		return 1
+	}
+	return s.lowestTier() + 2 - tier
+}
+
+// ProductMaxCount 商品可购买的数量上限
+func (s *Session) ProductMaxCount(p Product) int {
+	count := p.Count
+	if rule := s.matchPriority(p); rule != nil && rule.MaxCount > 0 {
+		count = rule.MaxCount
+	}
+	if p.BuyLimit > 0 && p.BuyLimit < count {
+		count = p.BuyLimit
+	}
+	// 下单商品列表不包含库存，以购物车中的商品为准，库存未知时不限制
+	stock := p.StockNumber
+	if item, ok := s.Cart.findItem(p.Id); ok && stock <= 0 {
+		stock = item.StockNumber
+	}
+	if stock > 0 && stock < count {
+		count = stock
+	}
+	return count
+}
+
+// ResetTierLimit 取消按优先级缩减，重新获取购物车时下单所有商品
+func (s *Session) ResetTierLimit() {
+	s.tierLimit = 0
+}
+
+// TierLimit 当前下单商品允许的最低优先级，0 表示不限制
+func (s *Session) TierLimit() int {
+	return s.tierLimit
+}
+
+// NarrowOrder 将下单商品缩减到更高一级的优先级，无法继续缩减时返回 false
+func (s *Session) NarrowOrder() bool {
+	current := 0
+	for _, p := range s.Order.Products {
+		if tier := s.ProductTier(p); tier > current {
+			current = tier
+		}
+	}
+	next := 0
+	for _, p := range s.Cart.ProdList {
+		if tier := s.ProductTier(p); tier < current && tier > next {
+			next = tier
+		}
+	}
+	if next == 0 {
+		return false
+	}
+	s.tierLimit = next
+	s.Order.Products = s.orderProducts(s.Cart.ProdList)
+	return len(s.Order.Products) > 0
+}
+
+// orderProducts 根据缺货记录和优先级限制生成下单商品
+func (s *Session) orderProducts(products []Product) []Product {
+	products = s.stockout.filter(products)
+	if s.tierLimit == 0 {
+		return products
+	}
+	result := make([]Product, 0, len(products))
+	for _, p := range products {
+		if s.ProductTier(p) <= s.tierLimit {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNarrowOrder(t *testing.T) {
+	const riceID = "6253d2a7b1d1d3d2a8f3e001"
+	priorities := []PriorityRule{{ID: testGingerID, Tier: 1}, {ID: testGarlicID, Tier: 2}}
+
+	tests := []struct {
+		name       string
+		priorities []PriorityRule
+		stockouts  []Product
+		// 每次缩减后的结果，nil 表示无法继续缩减
+		want [][]string
+	}{
+		{
+			name:       "逐级缩减",
+			priorities: priorities,
+			want:       [][]string{{testGingerID, testGarlicID}, {testGingerID}, nil},
+		},
+		{
+			name: "未配置优先级",
+			want: [][]string{nil},
+		},
+		{
+			name:       "缩减后没有可下单的商品",
+			priorities: priorities,
+			stockouts:  []Product{{Id: testGingerID}},
+			want:       [][]string{{testGarlicID}, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("test", 0)
+			if err := s.SetPriorities(tt.priorities); err != nil {
+				t.Fatal(err)
+			}
+			s.Cart.ProdList = []Product{{Id: testGingerID, Count: 1}, {Id: testGarlicID, Count: 1}, {Id: riceID, Count: 1}}
+			s.Order.Products = s.orderProducts(s.Cart.ProdList)
+			s.RemoveStockout(tt.stockouts)
+
+			for i, want := range tt.want {
+				ok := s.NarrowOrder()
+				if ok != (want != nil) {
+					t.Fatalf("NarrowOrder() #%d = %v, want %v", i, ok, want != nil)
+				}
+				if !ok {
+					break
+				}
+				var got []string
+				for _, p := range s.Order.Products {
+					got = append(got, p.Id)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("NarrowOrder() #%d products = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
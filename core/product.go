@@ -0,0 +1,93 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tidwall/gjson"
+)
+
+// Available 商品当前是否可购买
+func (p Product) Available() bool {
+	return p.StockNumber > 0 && p.TodayStockout == ""
+}
+
+// GetProduct 获取当前站点的商品详情
+func (s *Session) GetProduct(id string) (*Product, error) {
+	u, err := url.Parse("https://maicai.api.ddxq.mobi/guide-service/productApi/productDetail/info")
+	if err != nil {
+		return nil, fmt.Errorf("product url parse failed: %v", err)
+	}
+
+	params := s.buildURLParams(true)
+	params.Set("id", id)
+	u.RawQuery = params.Encode()
+	urlPath := u.String()
+
+	req := s.client.R()
+	req.Header = s.buildHeader()
+	resp, err := s.execute(context.Background(), req, http.MethodGet, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := gjson.GetBytes(resp.Body(), "data.detail")
+	if !detail.Exists() {
+		return nil, fmt.Errorf("未查询到商品: %s", id)
+	}
+	var product Product
+	if err := json.Unmarshal([]byte(detail.Raw), &product); err != nil {
+		return nil, fmt.Errorf("parse response failed: %v, body: %v", err, resp.String())
+	}
+	s.observe(SourceProduct, product)
+	return &product, nil
+}
+
+// SearchProducts 在当前站点搜索商品
+func (s *Session) SearchProducts(keyword string) ([]Product, error) {
+	u, err := url.Parse("https://maicai.api.ddxq.mobi/search/getSearchData")
+	if err != nil {
+		return nil, fmt.Errorf("search url parse failed: %v", err)
+	}
+
+	params := s.buildURLParams(true)
+	params.Set("keyword", keyword)
+	params.Set("page", "1")
+	u.RawQuery = params.Encode()
+	urlPath := u.String()
+
+	req := s.client.R()
+	req.Header = s.buildHeader()
+	resp, err := s.execute(context.Background(), req, http.MethodGet, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []Product
+	list := gjson.GetBytes(resp.Body(), "data.product_list")
+	if !list.Exists() {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(list.Raw), &products); err != nil {
+		return nil, fmt.Errorf("parse response failed: %v, body: %v", err, resp.String())
+	}
+	s.observe(SourceProduct, products...)
+	return products, nil
+}
@@ -32,9 +32,20 @@ type ReserveTime struct {
 	SelectMsg      string `json:"select_msg"`
 }
 
-func (s *Session) GetMultiReserveTime() ([]ReserveTime, error) {
+func (t ReserveTime) String() string {
+	startTime := time.Unix(int64(t.StartTimestamp), 0).Format("2006/01/02 15:04:05")
+	endTime := time.Unix(int64(t.EndTimestamp), 0).Format("2006/01/02 15:04:05")
+	return startTime + "——" + endTime
+}
+
+// GetMultiReserveTime 获取各包裹的可预约时间，结果与 GroupPackages 的包裹顺序一致
+func (s *Session) GetMultiReserveTime() ([][]ReserveTime, error) {
 	urlPath := "https://maicai.api.ddxq.mobi/order/getMultiReserveTime"
-	productsList := [][]Product{s.Order.Products}
+	packages := GroupPackages(s.Order.Products)
+	productsList := make([][]Product, 0, len(packages))
+	for _, p := range packages {
+		productsList = append(productsList, p.Products)
+	}
 	productsJson, err := json.Marshal(productsList)
 	if err != nil {
 		return nil, fmt.Errorf("marshal products info failed: %v", err)
@@ -56,18 +67,70 @@ func (s *Session) GetMultiReserveTime() ([]ReserveTime, error) {
 		return nil, err
 	}
 
-	reserveTimes := gjson.Get(resp.String(), "data.0.time.0.times").Array()
-	reserveTimeList := make([]ReserveTime, 0, len(reserveTimes))
-	for _, reserveTimeInfo := range reserveTimes {
-		if reserveTimeInfo.Get("disableType").Num != 0 {
-			continue
+	result := make([][]ReserveTime, 0, len(packages))
+	for i := range packages {
+		reserveTimes := gjson.Get(resp.String(), fmt.Sprintf("data.%d.time.0.times", i)).Array()
+		reserveTimeList := make([]ReserveTime, 0, len(reserveTimes))
+		for _, reserveTimeInfo := range reserveTimes {
+			if reserveTimeInfo.Get("disableType").Num != 0 {
+				continue
+			}
+			reserveTime := ReserveTime{
+				StartTimestamp: int(reserveTimeInfo.Get("start_timestamp").Num),
+				EndTimestamp:   int(reserveTimeInfo.Get("end_timestamp").Num),
+				SelectMsg:      reserveTimeInfo.Get("select_msg").Str,
+			}
+			reserveTimeList = append(reserveTimeList, reserveTime)
+		}
+		result = append(result, reserveTimeList)
+	}
+	return result, nil
+}
+
+// ReserveTimePlans 组合各包裹的可预约时间
+// 以第一个包裹的每个时间段作为一组，其余包裹选择相同的时间段，没有时选择之后最早的时间段
+// 其余包裹没有匹配的时间段时跳过该组，任一包裹无可预约时间时返回空
+func ReserveTimePlans(multiReserveTime [][]ReserveTime) [][]ReserveTime {
+	if len(multiReserveTime) == 0 {
+		return nil
+	}
+	for _, reserveTimes := range multiReserveTime {
+		if len(reserveTimes) == 0 {
+			return nil
+		}
+	}
+	plans := make([][]ReserveTime, 0, len(multiReserveTime[0]))
+	for _, reserveTime := range multiReserveTime[0] {
+		plan := []ReserveTime{reserveTime}
+		for _, reserveTimes := range multiReserveTime[1:] {
+			t, ok := matchReserveTime(reserveTime, reserveTimes)
+			if !ok {
+				plan = nil
+				break
+			}
+			plan = append(plan, t)
+		}
+		if plan != nil {
+			plans = append(plans, plan)
+		}
+	}
+	return plans
+}
+
+// matchReserveTime 从候选中选择与指定时间段相同的时间段，没有时选择之后开始的最早的时间段
+func matchReserveTime(t ReserveTime, candidates []ReserveTime) (ReserveTime, bool) {
+	var match *ReserveTime
+	for i := range candidates {
+		c := &candidates[i]
+		if c.StartTimestamp == t.StartTimestamp && c.EndTimestamp == t.EndTimestamp {
+			return *c, true
 		}
-		reserveTime := ReserveTime{
-			StartTimestamp: int(reserveTimeInfo.Get("start_timestamp").Num),
-			EndTimestamp:   int(reserveTimeInfo.Get("end_timestamp").Num),
-			SelectMsg:      reserveTimeInfo.Get("select_msg").Str,
+		if c.StartTimestamp >= t.StartTimestamp && (match == nil || c.StartTimestamp < match.StartTimestamp) {
+			match = c
 		}
-		reserveTimeList = append(reserveTimeList, reserveTime)
 	}
-	return reserveTimeList, nil
+	if match == nil {
+		return ReserveTime{}, false
+	}
+	return *match, true
 }
@@ -0,0 +1,147 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProductMatcher 按商品ID或名称正则匹配购物车商品
+type ProductMatcher struct {
+	ID      string `yaml:"id"`
+	Pattern string `yaml:"pattern"`
+
+	re *regexp.Regexp
+}
+
+func (m *ProductMatcher) compile() error {
+	if m.ID == "" && m.Pattern == "" {
+		return fmt.Errorf("商品匹配规则缺少id或pattern: %+v", *m)
+	}
+	if m.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(m.Pattern)
+	if err != nil {
+		return fmt.Errorf("商品匹配规则(%s)格式错误: %v", m.Pattern, err)
+	}
+	m.re = re
+	return nil
+}
+
+func (m *ProductMatcher) match(p Product) bool {
+	if m.ID != "" && m.ID == p.Id {
+		return true
+	}
+	return m.re != nil && m.re.MatchString(p.ProductName)
+}
+
+// CompileMatchers 校验并编译商品匹配规则
+func CompileMatchers(matchers []ProductMatcher) ([]ProductMatcher, error) {
+	result := make([]ProductMatcher, 0, len(matchers))
+	for _, m := range matchers {
+		if err := m.compile(); err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// MatchProduct 商品是否匹配任一规则
+func MatchProduct(matchers []ProductMatcher, p Product) bool {
+	for i := range matchers {
+		if matchers[i].match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// addedSet 程序加入购物车的商品(替代、凑单、购物清单)，按勾选规则勾选时始终保持勾选
+type addedSet struct {
+	mu  sync.RWMutex
+	ids map[string]struct{}
+}
+
+func newAddedSet() *addedSet {
+	return &addedSet{ids: make(map[string]struct{})}
+}
+
+func (s *addedSet) add(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.ids[id] = struct{}{}
+	}
+}
+
+func (s *addedSet) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+// SetCheckRules 设置下单前需要勾选的购物车商品，为空时勾选所有商品
+func (s *Session) SetCheckRules(rules []ProductMatcher) error {
+	matchers, err := CompileMatchers(rules)
+	if err != nil {
+		return err
+	}
+	s.checkRules = matchers
+	return nil
+}
+
+// SelectCart 只勾选匹配规则的商品并取消勾选其余商品，程序加入的商品保持勾选，返回勾选状态发生变化的商品数
+func (s *Session) SelectCart(matchers []ProductMatcher) (int, error) {
+	changed := 0
+	for _, p := range s.Cart.Items {
+		want := MatchProduct(matchers, p) || s.added.has(p.Id)
+		if want == (p.IsCheck == 1) {
+			continue
+		}
+		if err := s.CheckCart(p, want); err != nil {
+			return changed, fmt.Errorf("修改商品(%s)勾选状态失败: %v", p.ProductName, err)
+		}
+		if want {
+			logrus.Infof("勾选商品: %s", p.ProductName)
+		} else {
+			logrus.Infof("取消勾选商品: %s", p.ProductName)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// CheckCartItems 按勾选规则勾选下单商品，未配置规则时勾选所有商品
+// 勾选状态变化后重新获取购物车，保证下单商品与勾选结果一致
+func (s *Session) CheckCartItems() error {
+	if len(s.checkRules) == 0 {
+		return s.CartAllCheck()
+	}
+	changed, err := s.SelectCart(s.checkRules)
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return nil
+	}
+	return s.GetCart()
+}
@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -62,6 +63,11 @@ func NewSession(cookie string, interval int64) *Session {
 		Cart:         &Cart{},
 		Order:        &Order{},
 		PackageOrder: &PackageOrder{},
+		cartMu:       &sync.Mutex{},
+		cartEdits:    newCartEdits(),
+		stockout:     newStockoutSet(),
+		added:        newAddedSet(),
+		activityLog:  newActivityLog(),
 	}
 }
 
@@ -75,14 +81,44 @@ type Session struct {
 	appClientID string
 
 	UserID   string
+	User     *UserData
 	Address  *AddressItem
 	BarkId   string
 	PayType  int
 	CartMode int
+	MaxPrice Money // 订单金额上限，0 表示不限制
+	// 订单金额相对购物车金额的最大涨幅(%)，0 表示不限制
+	MaxPriceIncrease float64
+	// 校验订单金额时允许的误差
+	PriceTolerance Money
+	// 计算订单金额涨幅的基准金额，首次下单时记录的购物车金额
+	priceBaseline Money
 
-	Cart         *Cart
-	Order        *Order
-	PackageOrder *PackageOrder
+	CouponPolicy  CouponPolicy
+	Coupons       []Coupon
+	PaymentPolicy PaymentPolicy
+
+	Cart             *Cart
+	Order            *Order
+	PackageOrder     *PackageOrder
+	CheckOrderResult *CheckOrderResult // 最近一次检查订单的结果
+
+	// 并发获取购物车时保证购物车内容和变化对比一致
+	cartMu         *sync.Mutex
+	cartEdits      *cartEdits
+	stockout       *stockoutSet
+	added          *addedSet
+	activityLog    *activityLog
+	activityPolicy ActivityPolicy
+	checkRules     []ProductMatcher
+	pointsOff      bool
+	history        *HistoryStore
+	watchPrices    map[string]struct{}
+	onPriceDrop    func(PriceDrop)
+	onCartChange   func([]CartChange)
+	priorities     []PriorityRule
+	tierLimit      int
+	substitutes    map[string][]string
 }
 
 func (s *Session) Clone() *Session {
@@ -91,18 +127,45 @@ func (s *Session) Clone() *Session {
 		Interval: s.Interval,
 
 		UserID:   s.UserID,
+		User:     s.User,
 		Address:  s.Address,
 		BarkId:   s.BarkId,
 		PayType:  s.PayType,
 		CartMode: s.CartMode,
+		MaxPrice: s.MaxPrice,
+
+		MaxPriceIncrease: s.MaxPriceIncrease,
+		PriceTolerance:   s.PriceTolerance,
+		priceBaseline:    s.priceBaseline,
+
+		CouponPolicy:  s.CouponPolicy,
+		Coupons:       s.Coupons,
+		PaymentPolicy: s.PaymentPolicy,
+
+		Cart:             s.Cart,
+		Order:            s.Order,
+		PackageOrder:     s.PackageOrder,
+		CheckOrderResult: s.CheckOrderResult,
 
-		Cart:         s.Cart,
-		Order:        s.Order,
-		PackageOrder: s.PackageOrder,
-		apiVersion:   s.apiVersion,
-		appVersion:   s.appVersion,
-		channel:      s.channel,
-		appClientID:  s.appClientID,
+		cartMu:         s.cartMu,
+		cartEdits:      s.cartEdits,
+		stockout:       s.stockout,
+		added:          s.added,
+		activityLog:    s.activityLog,
+		activityPolicy: s.activityPolicy,
+		checkRules:     s.checkRules,
+		pointsOff:      s.pointsOff,
+		history:        s.history,
+		watchPrices:    s.watchPrices,
+		onPriceDrop:    s.onPriceDrop,
+		onCartChange:   s.onCartChange,
+		priorities:     s.priorities,
+		tierLimit:      s.tierLimit,
+		substitutes:    s.substitutes,
+		apiVersion:     s.apiVersion,
+		appVersion:     s.appVersion,
+		channel:        s.channel,
+		appClientID:    s.appClientID,
 	}
 }
 
@@ -141,7 +204,8 @@ func (s *Session) execute(ctx context.Context, request *resty.Request, method, u
 	case -1:
 		return nil, ErrOperator
 	default:
-		return nil, fmt.Errorf("无法识别的状态码: %v", resp.String())
+		// 保留响应内容，调用方可能需要从中解析失败详情(如缺货商品)
+		return resp, fmt.Errorf("无法识别的状态码: %v", resp.String())
 	}
 	duration := time.Duration(s.Interval + rand.Int63n(s.Interval/2))
 	//logrus.Warningf("将在 %dms 后重试, 当前人多拥挤(%v)(%s)", duration, actionName, resp.String())
@@ -0,0 +1,294 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SyncAdd    = "add"
+	SyncUpdate = "update"
+	SyncRemove = "remove"
+	SyncSkip   = "skip"
+	// 购物车中的商品已符合清单，无需调整
+	SyncKeep = "keep"
+)
+
+// ShoppingList 购物清单，同步时按清单调整购物车
+type ShoppingList struct {
+	// 清单所属的成员，合并清单时记录各成员需要的商品
+	Member string         `yaml:"member,omitempty"`
+	Items  []ShoppingItem `yaml:"items"`
+	// 保留购物车中不在清单里的商品，默认删除
+	KeepOthers bool `yaml:"keep_others"`
+}
+
+// ShoppingItem 购物清单中的商品，通过商品ID或搜索关键词指定
+type ShoppingItem struct {
+	ID string `yaml:"id,omitempty"`
+	// 搜索关键词，选择第一个可购买且符合规格和单价上限的商品
+	Search string `yaml:"search,omitempty"`
+	// 购买数量，默认为 1，超出限购时按限购数量购买
+	Count int `yaml:"count"`
+	// 规格名称，按名称匹配商品的规格
+	Size string `yaml:"size,omitempty"`
+	// 单价上限，0 表示不限制
+	MaxPrice Money `yaml:"max_price,omitempty"`
+	// 各成员需要的数量，由合并清单生成
+	Members map[string]int `yaml:"members,omitempty"`
+
+	// 同步时匹配到的商品ID
+	productId string
+}
+
+func (i ShoppingItem) String() string {
+	if i.ID != "" {
+		return i.ID
+	}
+	return i.Search
+}
+
+// SyncAction 同步购物清单时对购物车的一项调整
+type SyncAction struct {
+	Action  string
+	Product Product
+	// 调整后的数量
+	Count int
+	// 加购时选择的规格
+	Sizes  []map[string]interface{}
+	Reason string
+}
+
+func (a SyncAction) String() string {
+	var msg string
+	switch a.Action {
+	case SyncAdd:
+		msg = fmt.Sprintf("加购 %s x%d", a.Product.ProductName, a.Count)
+	case SyncUpdate:
+		msg = fmt.Sprintf("%s 数量 %d -> %d", a.Product.ProductName, a.Product.Count, a.Count)
+	case SyncRemove:
+		msg = fmt.Sprintf("删除 %s", a.Product.ProductName)
+	case SyncKeep:
+		msg = fmt.Sprintf("保留 %s x%d", a.Product.ProductName, a.Count)
+	default:
+		msg = fmt.Sprintf("跳过 %s", a.Product.ProductName)
+	}
+	if a.Reason != "" {
+		msg += fmt.Sprintf("(%s)", a.Reason)
+	}
+	return msg
+}
+
+// SizeName 规格的名称
+func SizeName(size map[string]interface{}) string {
+	for _, key := range []string{"name", "title", "value"} {
+		if v, ok := size[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// matchSize 商品已选规格是否符合清单，未指定规格时均符合
+func matchSize(p Product, size string) bool {
+	if size == "" {
+		return true
+	}
+	for _, s := range p.Sizes {
+		if strings.Contains(SizeName(s), size) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectSize 从商品可选规格中选择名称匹配的规格
+func SelectSize(p Product, size string) ([]map[string]interface{}, bool) {
+	if size == "" {
+		return nil, true
+	}
+	for _, s := range p.Sizes {
+		if strings.Contains(SizeName(s), size) {
+			return []map[string]interface{}{s}, true
+		}
+	}
+	return nil, false
+}
+
+// resolveItem 查找清单商品对应的商品，优先使用购物车中已有的商品
+func (s *Session) resolveItem(item ShoppingItem) (*Product, bool, error) {
+	if item.ID != "" {
+		if p, ok := s.Cart.findItem(item.ID); ok {
+			return &p, true, nil
+		}
+		p, err := s.GetProduct(item.ID)
+		return p, false, err
+	}
+
+	candidates, err := s.SearchProducts(item.Search)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, c := range candidates {
+		if p, ok := s.Cart.findItem(c.Id); ok {
+			return &p, true, nil
+		}
+	}
+	for i := range candidates {
+		c := &candidates[i]
+		if !c.Available() || (item.MaxPrice > 0 && c.Price > item.MaxPrice) {
+			continue
+		}
+		if _, ok := SelectSize(*c, item.Size); !ok {
+			continue
+		}
+		return c, false, nil
+	}
+	return nil, false, fmt.Errorf("未搜索到可购买的商品")
+}
+
+// PlanSync 对比购物清单和购物车，生成购物车的调整方案
+func (s *Session) PlanSync(list *ShoppingList) ([]SyncAction, error) {
+	var actions []SyncAction
+	var unresolved []string
+	wanted := make(map[string]struct{})
+	for i := range list.Items {
+		item := list.Items[i]
+		if item.ID == "" && item.Search == "" {
+			return nil, fmt.Errorf("购物清单商品缺少id或search: %+v", item)
+		}
+		p, inCart, err := s.resolveItem(item)
+		if err != nil {
+			actions = append(actions, SyncAction{
+				Action:  SyncSkip,
+				Product: Product{Id: item.ID, ProductName: item.String()},
+				Reason:  err.Error(),
+			})
+			unresolved = append(unresolved, item.String())
+			continue
+		}
+		wanted[p.Id] = struct{}{}
+		list.Items[i].productId = p.Id
+
+		count := item.Count
+		if count <= 0 {
+			count = 1
+		}
+		var reason string
+		if p.BuyLimit > 0 && count > p.BuyLimit {
+			count = p.BuyLimit
+			reason = fmt.Sprintf("限购 %d 件", p.BuyLimit)
+		}
+		if item.MaxPrice > 0 && p.Price > item.MaxPrice {
+			actions = append(actions, SyncAction{Action: SyncSkip, Product: *p,
+				Reason: fmt.Sprintf("单价 %s 超出上限 %s", p.Price, item.MaxPrice)})
+			continue
+		}
+
+		if inCart && matchSize(*p, item.Size) {
+			action := SyncUpdate
+			if p.Count == count {
+				action = SyncKeep
+			}
+			actions = append(actions, SyncAction{Action: action, Product: *p, Count: count, Reason: reason})
+			continue
+		}
+
+		target := p
+		if inCart {
+			// 购物车中的规格与清单不同时，删除后按清单规格重新加购
+			if target, err = s.GetProduct(p.Id); err != nil {
+				actions = append(actions, SyncAction{Action: SyncSkip, Product: *p, Reason: err.Error()})
+				continue
+			}
+		}
+		sizes, ok := SelectSize(*target, item.Size)
+		if !ok {
+			actions = append(actions, SyncAction{Action: SyncSkip, Product: *p,
+				Reason: fmt.Sprintf("没有规格 %s", item.Size)})
+			continue
+		}
+		if !target.Available() {
+			actions = append(actions, SyncAction{Action: SyncSkip, Product: *p, Reason: "已售罄"})
+			continue
+		}
+		if inCart {
+			actions = append(actions, SyncAction{Action: SyncRemove, Product: *p, Reason: "规格不符"})
+		}
+		actions = append(actions, SyncAction{Action: SyncAdd, Product: *target, Count: count, Sizes: sizes, Reason: reason})
+	}
+
+	if list.KeepOthers {
+		return actions, nil
+	}
+	if len(unresolved) > 0 {
+		// 无法确定购物车商品是否对应查找失败的清单商品，不删除任何不在清单中的商品
+		logrus.Warningf("购物清单商品查找失败(%s)，本次不删除购物车中的其他商品", strings.Join(unresolved, ", "))
+		return actions, nil
+	}
+	for _, products := range [][]Product{s.Cart.Items, s.Cart.Invalid} {
+		for _, p := range products {
+			if _, ok := wanted[p.Id]; !ok {
+				actions = append(actions, SyncAction{Action: SyncRemove, Product: p, Reason: "不在购物清单中"})
+			}
+		}
+	}
+	return actions, nil
+}
+
+// ApplySync 按调整方案修改购物车，有修改时重新获取购物车
+// 清单中的商品不受勾选规则影响
+func (s *Session) ApplySync(actions []SyncAction) error {
+	var removes []Product
+	changed := false
+	for _, a := range actions {
+		if a.Action == SyncRemove {
+			removes = append(removes, a.Product)
+		}
+		if a.Action != SyncSkip && a.Action != SyncKeep {
+			changed = true
+		}
+	}
+	if len(removes) > 0 {
+		if err := s.RemoveCart(removes...); err != nil {
+			return fmt.Errorf("删除购物车商品失败: %v", err)
+		}
+	}
+
+	for _, a := range actions {
+		switch a.Action {
+		case SyncAdd:
+			if err := s.AddCartWithSizes(a.Product.Id, a.Count, a.Sizes); err != nil {
+				return fmt.Errorf("加购商品(%s)失败: %v", a.Product.ProductName, err)
+			}
+			s.added.add(a.Product.Id)
+		case SyncUpdate:
+			if err := s.UpdateCart(a.Product, a.Count); err != nil {
+				return fmt.Errorf("修改商品(%s)数量失败: %v", a.Product.ProductName, err)
+			}
+			s.added.add(a.Product.Id)
+		case SyncKeep:
+			s.added.add(a.Product.Id)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.GetCart()
+}
@@ -0,0 +1,172 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// offlineTransport 模拟网络不可用，使需要请求接口的商品查找失败
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+func TestPlanSync(t *testing.T) {
+	// 购物车中的失效商品
+	removeInvalid := []string{"remove:614d6cce8f1ed4f0871a2ca9:0", "remove:58ba8c02916edf9e4cc23072:0"}
+	tests := []struct {
+		name string
+		list ShoppingList
+		want []string
+	}{
+		{
+			name: "保留并修改数量",
+			list: ShoppingList{KeepOthers: true, Items: []ShoppingItem{
+				{ID: testGingerID, Count: 1},
+				{ID: testGarlicID, Count: 3},
+			}},
+			want: []string{"keep:" + testGingerID + ":1", "update:" + testGarlicID + ":3"},
+		},
+		{
+			name: "删除不在清单中的商品",
+			list: ShoppingList{Items: []ShoppingItem{{ID: testGingerID, Count: 1}}},
+			want: append([]string{"keep:" + testGingerID + ":1", "remove:" + testGarlicID + ":0"}, removeInvalid...),
+		},
+		{
+			name: "超出单价上限时跳过但不删除",
+			list: ShoppingList{Items: []ShoppingItem{{ID: testGingerID, Count: 1, MaxPrice: 400}}},
+			want: append([]string{"skip:" + testGingerID + ":0", "remove:" + testGarlicID + ":0"}, removeInvalid...),
+		},
+		{
+			name: "查找失败时不删除其他商品",
+			list: ShoppingList{Items: []ShoppingItem{
+				{ID: testGingerID, Count: 1},
+				{ID: "unknown", Count: 1},
+			}},
+			want: []string{"keep:" + testGingerID + ":1", "skip:unknown:0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testCartSession(t)
+			s.Address = &AddressItem{}
+			s.client.SetTransport(offlineTransport{})
+
+			actions, err := s.PlanSync(&tt.list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(actions))
+			for _, a := range actions {
+				got = append(got, fmt.Sprintf("%s:%s:%d", a.Action, a.Product.Id, a.Count))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PlanSync() = %v, want %v", got, tt.want)
+			}
+			// 生成方案不修改会话状态
+			if s.added.has(testGingerID) {
+				t.Error("PlanSync() 不应标记清单商品")
+			}
+		})
+	}
+}
+
+func TestApplySyncKeep(t *testing.T) {
+	s := testCartSession(t)
+	s.client.SetTransport(offlineTransport{})
+	actions := []SyncAction{{Action: SyncKeep, Product: Product{Id: testGingerID}, Count: 1}}
+	// 无需修改购物车时不请求接口
+	if err := s.ApplySync(actions); err != nil {
+		t.Fatal(err)
+	}
+	if !s.added.has(testGingerID) {
+		t.Error("ApplySync() 未标记保留的清单商品")
+	}
+}
+
+func TestMergeShoppingLists(t *testing.T) {
+	tests := []struct {
+		name      string
+		lists     []*ShoppingList
+		want      []ShoppingItem
+		keep      bool
+		conflicts int
+	}{
+		{
+			name: "相同商品数量相加",
+			lists: []*ShoppingList{
+				{Member: "alice", Items: []ShoppingItem{{ID: testGingerID, Count: 2}}},
+				{Member: "bob", Items: []ShoppingItem{{ID: testGingerID}, {Search: "鸡蛋", Count: 1}}},
+			},
+			want: []ShoppingItem{
+				{ID: testGingerID, Count: 3, Members: map[string]int{"alice": 2, "bob": 1}},
+				{Search: "鸡蛋", Count: 1, Members: map[string]int{"bob": 1}},
+			},
+		},
+		{
+			name: "规格冲突时保留第一个",
+			lists: []*ShoppingList{
+				{Member: "alice", Items: []ShoppingItem{{Search: "鸡蛋", Count: 1, Size: "30枚"}}},
+				{Member: "bob", Items: []ShoppingItem{{Search: " 鸡蛋", Count: 1, Size: "10枚"}}},
+			},
+			want: []ShoppingItem{
+				{Search: "鸡蛋", Count: 2, Size: "30枚", Members: map[string]int{"alice": 1, "bob": 1}},
+			},
+			conflicts: 1,
+		},
+		{
+			name: "单价上限取最低值",
+			lists: []*ShoppingList{
+				{Member: "alice", Items: []ShoppingItem{{ID: testGingerID, Count: 1, MaxPrice: 500}}},
+				{Member: "bob", Items: []ShoppingItem{{ID: testGingerID, Count: 1, MaxPrice: 400}}},
+			},
+			want: []ShoppingItem{
+				{ID: testGingerID, Count: 2, MaxPrice: 400, Members: map[string]int{"alice": 1, "bob": 1}},
+			},
+			conflicts: 1,
+		},
+		{
+			name: "保留其他商品",
+			lists: []*ShoppingList{
+				{Items: []ShoppingItem{{ID: testGingerID, Count: 1}}},
+				{Member: "bob", KeepOthers: true},
+			},
+			want: []ShoppingItem{
+				{ID: testGingerID, Count: 1, Members: map[string]int{unassignedMember: 1}},
+			},
+			keep: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := MergeShoppingLists(tt.lists)
+			if !reflect.DeepEqual(merged.Items, tt.want) {
+				t.Errorf("MergeShoppingLists() items = %+v, want %+v", merged.Items, tt.want)
+			}
+			if merged.KeepOthers != tt.keep {
+				t.Errorf("MergeShoppingLists() keep_others = %v, want %v", merged.KeepOthers, tt.keep)
+			}
+			if len(conflicts) != tt.conflicts {
+				t.Errorf("MergeShoppingLists() conflicts = %v, want %d", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// StockoutError 提交订单时服务端返回的缺货商品
+type StockoutError struct {
+	Products []Product
+}
+
+func (e *StockoutError) Error() string {
+	names := make([]string, 0, len(e.Products))
+	for _, p := range e.Products {
+		names = append(names, p.ProductName)
+	}
+	return "商品缺货: " + strings.Join(names, ", ")
+}
+
+// stockoutSet 记录缺货商品的可购买数量，购物车刷新后依旧生效，商品恢复供应或开始新一轮下单时清除
+type stockoutSet struct {
+	mu     sync.RWMutex
+	limits map[string]int
+}
+
+func newStockoutSet() *stockoutSet {
+	return &stockoutSet{limits: make(map[string]int)}
+}
+
+func (s *stockoutSet) set(id string, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits[id] = limit
+}
+
+func (s *stockoutSet) get(id string) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	limit, ok := s.limits[id]
+	return limit, ok
+}
+
+func (s *stockoutSet) clear(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.limits, id)
+}
+
+func (s *stockoutSet) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = make(map[string]int)
+}
+
+// filter 按缺货记录剔除或减少商品数量
+func (s *stockoutSet) filter(products []Product) []Product {
+	result := make([]Product, 0, len(products))
+	for _, p := range products {
+		limit, ok := s.get(p.Id)
+		if !ok {
+			result = append(result, p)
+			continue
+		}
+		if limit <= 0 {
+			continue
+		}
+		if p.Count > limit {
+			p.Count = limit
+			p.TotalPrice = p.Price.Mul(limit)
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// RemoveStockout 记录缺货商品并调整下单商品列表，返回调整说明
+func (s *Session) RemoveStockout(stockouts []Product) []string {
+	var changes []string
+	for _, stockout := range stockouts {
+		limit := stockout.StockNumber
+		var current *Product
+		for i := range s.Order.Products {
+			if s.Order.Products[i].Id == stockout.Id {
+				current = &s.Order.Products[i]
+				break
+			}
+		}
+		if current == nil {
+			continue
+		}
+		// 仍有库存时最多购买库存数量，不超过原来的数量
+		switch {
+		case limit <= 0:
+			limit = 0
+			changes = append(changes, fmt.Sprintf("%s x%d 已移除", current.ProductName, current.Count))
+		case limit < current.Count:
+			changes = append(changes, fmt.Sprintf("%s 数量 %d -> %d", current.ProductName, current.Count, limit))
+		default:
+			limit = current.Count
+		}
+		s.stockout.set(stockout.Id, limit)
+	}
+	s.Order.Products = s.stockout.filter(s.Order.Products)
+	return changes
+}
+
+// ResetStockout 清除缺货记录，每次下单流程开始时调用
+func (s *Session) ResetStockout() {
+	s.stockout.reset()
+}
@@ -0,0 +1,92 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemoveStockout(t *testing.T) {
+	tests := []struct {
+		name      string
+		stockouts []Product
+		want      map[string]int
+		changes   int
+	}{
+		{
+			name:      "无库存时移除",
+			stockouts: []Product{{Id: testGingerID}},
+			want:      map[string]int{testGarlicID: 2},
+			changes:   1,
+		},
+		{
+			name:      "库存不足时减少数量",
+			stockouts: []Product{{Id: testGingerID, StockNumber: 1}},
+			want:      map[string]int{testGingerID: 1, testGarlicID: 2},
+			changes:   1,
+		},
+		{
+			name:      "库存充足时保留原数量",
+			stockouts: []Product{{Id: testGingerID, StockNumber: 5}},
+			want:      map[string]int{testGingerID: 3, testGarlicID: 2},
+		},
+		{
+			name:      "忽略不在订单中的商品",
+			stockouts: []Product{{Id: "unknown"}},
+			want:      map[string]int{testGingerID: 3, testGarlicID: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("test", 0)
+			s.Order.Products = []Product{
+				{Id: testGingerID, Price: 459, Count: 3},
+				{Id: testGarlicID, Price: 499, Count: 2},
+			}
+			changes := s.RemoveStockout(tt.stockouts)
+			if len(changes) != tt.changes {
+				t.Errorf("RemoveStockout() changes = %v, want %d", changes, tt.changes)
+			}
+			got := make(map[string]int)
+			for _, p := range s.Order.Products {
+				got[p.Id] = p.Count
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RemoveStockout() products = %v, want %v", got, tt.want)
+			}
+			// 购物车刷新后缺货记录依旧生效
+			if filtered := s.stockout.filter(s.Order.Products); len(filtered) != len(s.Order.Products) {
+				t.Errorf("filter() = %v, want %v", filtered, s.Order.Products)
+			}
+		})
+	}
+}
+
+func TestStockoutClearedOnRestock(t *testing.T) {
+	s := NewSession("test", 0)
+	s.Order.Products = []Product{{Id: testGingerID, Count: 1}}
+	s.RemoveStockout([]Product{{Id: testGingerID}})
+	if _, ok := s.stockout.get(testGingerID); !ok {
+		t.Fatal("缺货商品未记录")
+	}
+
+	before := []Product{{Id: testGingerID, Count: 1}}
+	s.Cart.Items = []Product{{Id: testGingerID, Count: 1, StockNumber: 10}}
+	s.reportCartChanges(before, nil)
+	if _, ok := s.stockout.get(testGingerID); ok {
+		t.Error("恢复供应后缺货记录未清除")
+	}
+}
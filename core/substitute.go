@@ -0,0 +1,137 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SubstituteRule 商品不可用时按顺序尝试的替代商品
+type SubstituteRule struct {
+	ID           string   `yaml:"id"`
+	Alternatives []string `yaml:"alternatives"`
+}
+
+// Substitution 一次商品替换记录
+type Substitution struct {
+	From Product `json:"from"`
+	To   Product `json:"to"`
+}
+
+func (s Substitution) String() string {
+	return fmt.Sprintf("%s -> %s x%d", s.From.ProductName, s.To.ProductName, s.To.Count)
+}
+
+// SetSubstitutes 设置替代商品规则
+func (s *Session) SetSubstitutes(rules []SubstituteRule) error {
+	result := make(map[string][]string, len(rules))
+	for _, rule := range rules {
+		if rule.ID == "" || len(rule.Alternatives) == 0 {
+			return fmt.Errorf("替代商品规则缺少id或alternatives: %+v", rule)
+		}
+		result[rule.ID] = rule.Alternatives
+	}
+	s.substitutes = result
+	return nil
+}
+
+// Substitute 为不可用的商品加购第一个可用的替代商品(数量相同)，返回本次的替换记录
+func (s *Session) Substitute(unavailable []Product) ([]Substitution, error) {
+	var result []Substitution
+	for _, p := range unavailable {
+		alternatives := s.substitutes[p.Id]
+		if len(alternatives) == 0 || s.substituted(p.Id) || s.ordering(p.Id) {
+			continue
+		}
+		count := p.Count
+		if cp, ok := s.Cart.findProduct(p.Id); ok {
+			count = cp.Count
+		}
+		if count <= 0 {
+			count = 1
+		}
+
+		for _, id := range alternatives {
+			alt, ok := s.Cart.findProduct(id)
+			if !ok {
+				if err := s.AddCart(id, count); err != nil {
+					logrus.Warningf("添加替代商品(%s)失败: %v", id, err)
+					continue
+				}
+				if err := s.GetCart(); err != nil {
+					return result, err
+				}
+				alt, ok = s.Cart.findProduct(id)
+			}
+			if !ok {
+				logrus.Warningf("替代商品(%s)不可用", id)
+				continue
+			}
+			if alt.Count < count {
+				var err error
+				if alt, err = s.raiseSubstitute(alt, count); err != nil {
+					return result, err
+				}
+			}
+			s.added.add(alt.Id)
+			sub := Substitution{From: p, To: alt}
+			s.Order.Substitutions = append(s.Order.Substitutions, sub)
+			result = append(result, sub)
+			break
+		}
+	}
+	return result, nil
+}
+
+// raiseSubstitute 替代商品已在购物车中时数量补足到被替代商品的数量，修改失败时保持原数量
+func (s *Session) raiseSubstitute(alt Product, count int) (Product, error) {
+	// 下单商品列表不包含勾选状态，以购物车中的商品为准
+	item, ok := s.Cart.findItem(alt.Id)
+	if !ok {
+		item = alt
+	}
+	if err := s.UpdateCart(item, count); err != nil {
+		logrus.Warningf("修改替代商品(%s)数量失败: %v", alt.ProductName, err)
+		return alt, nil
+	}
+	if err := s.GetCart(); err != nil {
+		return alt, err
+	}
+	if updated, ok := s.Cart.findProduct(alt.Id); ok {
+		return updated, nil
+	}
+	return alt, nil
+}
+
+func (s *Session) substituted(id string) bool {
+	for _, sub := range s.Order.Substitutions {
+		if sub.From.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ordering 商品是否仍在下单商品中(如缺货时仅减少了数量)
+func (s *Session) ordering(id string) bool {
+	for _, p := range s.Order.Products {
+		if p.Id == id {
+			return true
+		}
+	}
+	return false
+}
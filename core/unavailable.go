@@ -0,0 +1,83 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import "fmt"
+
+// UnavailableProduct 不会下单或无法全部下单的购物车商品
+type UnavailableProduct struct {
+	Product Product
+	Reason  string
+}
+
+func (u UnavailableProduct) String() string {
+	return fmt.Sprintf("%s: %s", u.Product.ProductName, u.Reason)
+}
+
+// soldOutReason 商品售罄的原因，未售罄时返回空
+func soldOutReason(p Product) string {
+	if p.TodayStockout != "" {
+		return fmt.Sprintf("今日已售罄(%s)", p.TodayStockout)
+	}
+	if p.StockNumber <= 0 {
+		return "已售罄"
+	}
+	return ""
+}
+
+// UnavailableProducts 根据购物车和下单商品列出不会下单或无法全部下单的商品及原因
+func (s *Session) UnavailableProducts() []UnavailableProduct {
+	ordered := make(map[string]Product, len(s.Order.Products))
+	for _, p := range s.Order.Products {
+		ordered[p.Id] = p
+	}
+	selected := make(map[string]struct{}, len(s.Cart.ProdList))
+	for _, p := range s.Cart.ProdList {
+		selected[p.Id] = struct{}{}
+	}
+
+	var result []UnavailableProduct
+	for _, p := range s.Cart.Items {
+		o, ok := ordered[p.Id]
+		_, isSelected := selected[p.Id]
+		reason := soldOutReason(p)
+		switch {
+		case reason != "":
+		case ok && o.Count < p.Count:
+			reason = fmt.Sprintf("库存不足，仅购买 %d/%d 件", o.Count, p.Count)
+		case ok && p.BuyLimit > 0 && p.Count > p.BuyLimit:
+			reason = fmt.Sprintf("超出限购，最多购买 %d 件", p.BuyLimit)
+		case ok && p.Count > p.StockNumber:
+			reason = fmt.Sprintf("库存仅剩 %d 件", p.StockNumber)
+		case ok:
+			continue
+		case p.IsCheck != 1:
+			reason = "未勾选"
+		case !isSelected:
+			reason = "换购或赠品策略排除"
+		default:
+			reason = "缺货或优先级限制排除"
+		}
+		result = append(result, UnavailableProduct{Product: p, Reason: reason})
+	}
+	for _, p := range s.Cart.Invalid {
+		reason := soldOutReason(p)
+		if reason == "" {
+			reason = "已失效，当前站点无法配送"
+		}
+		result = append(result, UnavailableProduct{Product: p, Reason: reason})
+	}
+	return result
+}
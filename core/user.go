@@ -48,6 +48,11 @@ type UserData struct {
 	NoCommentOrderNum   int         `json:"no_comment_order_num"`
 }
 
+// IsVIP 是否为有效会员
+func (v UserVIP) IsVIP() bool {
+	return v.VipStatus == 1
+}
+
 type UserVIP struct {
 	IsRenew                  int    `json:"is_renew"`
 	VipSaveMoneyDescription  string `json:"vip_save_money_description"`
@@ -65,9 +70,33 @@ type UserSign struct {
 }
 
 type UserBalance struct {
-	SetFingerPayPassword int    `json:"set_finger_pay_password"`
-	Balance              string `json:"balance"`
-	SetPayPassword       int    `json:"set_pay_password"`
+	SetFingerPayPassword int   `json:"set_finger_pay_password"`
+	Balance              Money `json:"balance"`
+	SetPayPassword       int   `json:"set_pay_password"`
+	// 余额能否正常解析，无法解析时不使用余额支付
+	BalanceKnown bool `json:"-"`
+}
+
+// UnmarshalJSON 余额格式无法解析时不影响获取用户信息，视为余额未知
+func (b *UserBalance) UnmarshalJSON(data []byte) error {
+	type alias UserBalance
+	v := struct {
+		*alias
+		Balance json.RawMessage `json:"balance"`
+	}{alias: (*alias)(b)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	b.Balance, b.BalanceKnown = 0, false
+	if len(v.Balance) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(v.Balance, &b.Balance); err != nil {
+		logrus.Warningf("无法解析账户余额(%s)，不会使用余额支付: %v", v.Balance, err)
+		return nil
+	}
+	b.BalanceKnown = true
+	return nil
 }
 
 type UserInfo struct {
@@ -111,6 +140,7 @@ func (s *Session) GetUser() error {
 	}
 
 	s.UserID = userResult.Data.UserInfo.Id
+	s.User = &userResult.Data
 	logrus.Infof("获取用户信息成功, id: %s, name: %s", s.UserID, userResult.Data.UserInfo.Name)
 	return nil
 }
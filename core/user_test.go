@@ -0,0 +1,49 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUserBalanceUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		balance  Money
+		known    bool
+		password int
+	}{
+		{name: "字符串金额", data: `{"balance":"12.30","set_pay_password":1}`, balance: 1230, known: true, password: 1},
+		{name: "数字金额", data: `{"balance":8}`, balance: 800, known: true},
+		{name: "无法解析", data: `{"balance":"--","set_pay_password":1}`, password: 1},
+		{name: "缺少余额", data: `{"set_pay_password":1}`, password: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b UserBalance
+			if err := json.Unmarshal([]byte(tt.data), &b); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if b.Balance != tt.balance || b.BalanceKnown != tt.known {
+				t.Errorf("Unmarshal() = %s, %v, want %s, %v", b.Balance, b.BalanceKnown, tt.balance, tt.known)
+			}
+			if b.SetPayPassword != tt.password {
+				t.Errorf("Unmarshal() set_pay_password = %d, want %d", b.SetPayPassword, tt.password)
+			}
+		})
+	}
+}
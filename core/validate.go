@@ -0,0 +1,80 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError 提交订单前校验未通过
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "订单校验未通过: " + strings.Join(e.Violations, "; ")
+}
+
+// SetPriceBaseline 记录当前购物车金额作为订单金额涨幅的基准，已记录时不再更新，
+// 避免购物车中的商品在下单过程中涨价后以涨价后的金额为基准
+func (s *Session) SetPriceBaseline() {
+	if s.priceBaseline == 0 {
+		s.priceBaseline = s.Cart.TotalMoney
+	}
+}
+
+// ValidateOrder 提交订单前校验订单金额
+func (s *Session) ValidateOrder() error {
+	var violations []string
+	if err := s.CheckPriceLimit(); err != nil {
+		violations = append(violations, err.Error())
+	}
+
+	price := s.PackageOrder.PaymentOrder.Price
+	baseline := s.priceBaseline
+	if baseline == 0 {
+		baseline = s.Cart.TotalMoney
+	}
+	if s.MaxPriceIncrease > 0 && baseline > 0 {
+		increase := (price - baseline).Float() / baseline.Float() * 100
+		if increase > s.MaxPriceIncrease {
+			violations = append(violations, fmt.Sprintf("订单金额 %s 较购物车金额 %s 上涨 %.1f%%，超出 %.1f%%",
+				price, baseline, increase, s.MaxPriceIncrease))
+		}
+	}
+
+	var total Money
+	for _, p := range s.Order.Products {
+		total += p.TotalPrice
+	}
+	freight := s.PackageOrder.PaymentOrder.OrderFreight
+	// 优惠包括优惠券、积分以及检查订单返回的商品立减和活动优惠
+	discount := s.Order.CouponMoney + s.Order.UsedPointMoney + s.Order.RebateMoney
+	diff := total + freight - discount - price
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > s.PriceTolerance {
+		violations = append(violations, fmt.Sprintf("商品金额 %s + 运费 %s - 优惠 %s 与订单金额 %s 相差 %s，超出允许误差 %s",
+			total, freight, discount, price, diff, s.PriceTolerance))
+	}
+	violations = append(violations, s.validatePayment()...)
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright © 2022 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(s *Session)
+		wantCount int
+	}{
+		{
+			name:  "金额一致",
+			setup: func(s *Session) {},
+		},
+		{
+			name:      "超出金额上限",
+			setup:     func(s *Session) { s.MaxPrice = 2000 },
+			wantCount: 1,
+		},
+		{
+			name: "较基准金额涨幅过大",
+			setup: func(s *Session) {
+				s.MaxPriceIncrease = 10
+				s.Cart.TotalMoney = 1500
+				s.SetPriceBaseline()
+				// 购物车涨价后仍以记录的基准金额计算涨幅
+				s.Cart.TotalMoney = 2500
+			},
+			wantCount: 1,
+		},
+		{
+			name: "涨幅在范围内",
+			setup: func(s *Session) {
+				s.MaxPriceIncrease = 30
+				s.Cart.TotalMoney = 2000
+			},
+		},
+		{
+			name:      "金额明细不一致",
+			setup:     func(s *Session) { s.PackageOrder.PaymentOrder.Price = 2600 },
+			wantCount: 1,
+		},
+		{
+			name: "差额在允许误差内",
+			setup: func(s *Session) {
+				s.PriceTolerance = 10
+				s.PackageOrder.PaymentOrder.Price = 2505
+			},
+		},
+		{
+			name: "优惠计入订单金额",
+			setup: func(s *Session) {
+				s.Order.CouponMoney = 300
+				s.Order.RebateMoney = 200
+				s.PackageOrder.PaymentOrder.Price = 2000
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("test", 0)
+			s.Order.Products = []Product{
+				{Id: testGingerID, Price: 459, Count: 2, TotalPrice: 918},
+				{Id: testGarlicID, Price: 499, Count: 2, TotalPrice: 998},
+			}
+			s.Order.Price = 2500
+			s.PackageOrder.PaymentOrder.Price = 2500
+			s.PackageOrder.PaymentOrder.OrderFreight = 584
+			tt.setup(s)
+
+			err := s.ValidateOrder()
+			if tt.wantCount == 0 {
+				if err != nil {
+					t.Fatalf("ValidateOrder() error = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ValidateOrder() error = %v, want ValidationError", err)
+			}
+			if len(validationErr.Violations) != tt.wantCount {
+				t.Errorf("ValidateOrder() violations = %v, want %d", validationErr.Violations, tt.wantCount)
+			}
+		})
+	}
+}
@@ -9,6 +9,9 @@ require (
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.4.0
 	github.com/tidwall/gjson v1.14.0
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -24,6 +27,5 @@ require (
 	golang.org/x/image v0.0.0-20220412021310-99f80d0ecbab // indirect
 	golang.org/x/mobile v0.0.0-20220407111146-e579adbbc4a2 // indirect
 	golang.org/x/net v0.0.0-20220407224826-aac1ed45d8e3 // indirect
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.0.0-20220412015802-83041a38b14a // indirect
 )